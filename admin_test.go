@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// WithManagementToken включает ручки /admin/, они пускают только с Authorization: Bearer <token>.
+// Без токена ручек нет совсем
+func WithManagementToken(token string) ServerOption {
+	return func(s *SearchServer) {
+		s.managementToken = token
+	}
+}
+
+func (s *SearchServer) registerAdmin() {
+	if s.managementToken == "" {
+		return
+	}
+	auth := bearerAuth(s.managementToken)
+	if s.adminAllowlist != nil {
+		auth = Chain(s.adminAllowlist, auth)
+	}
+	admin := func(pattern, summary string, methods []string, h http.HandlerFunc, doc routeDoc) {
+		doc.Summary, doc.Methods, doc.Auth = summary, methods, true
+		s.handle(pattern, auth(h), doc)
+	}
+	get, post := []string{http.MethodGet}, []string{http.MethodPost}
+	admin("/admin/reindex", "Rebuild the search index", post, s.reindex, routeDoc{Response: map[string]interface{}{}})
+	admin("/admin/benchmark", "Benchmark a search request", post, s.benchmark, routeDoc{
+		Request: benchmarkRequest{}, Response: BenchmarkResult{},
+	})
+	admin("/admin/traces", "Recent search traces", get, s.tracesHandler, routeDoc{
+		Params:   []ParamDoc{{Name: "last", Type: "int", Minimum: intPtr(1), Default: strconv.Itoa(defaultTracesLast)}},
+		Response: []RequestTrace{},
+	})
+	admin("/admin/import", "Import users from an uploaded dataset.xml", post, s.importUsers, routeDoc{Response: ImportResult{}})
+	admin("/admin/config", "Change runtime settings", []string{http.MethodPatch}, s.configHandler, routeDoc{
+		Request: ServerConfig{}, Response: ServerConfig{},
+	})
+	admin("/dataset.xml", "Export the dataset as XML", get, s.exportXML, routeDoc{ContentType: "application/xml"})
+	admin("/dataset.json", "Export the dataset as JSON", get, s.exportJSON, routeDoc{Response: []Row{}})
+}
+
+// reindex строит новый индекс по текущим данным, пока он строится, поиск идёт по старому
+func (s *SearchServer) reindex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	start := time.Now()
+	rows := s.data().Rows
+	s.index.Store(buildSearchIndex(rows))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "ok",
+		"duration_ms":  time.Since(start).Milliseconds(),
+		"rows_indexed": len(rows),
+	})
+}
+
+// exportXML отдаёт текущие данные со всеми правками в том же формате, что и dataset.xml.
+// Как и в файле, About остаётся зашифрованным, если включено WithAboutEncryption
+func (s *SearchServer) exportXML(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="dataset.xml"`)
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	ds := s.stored()
+	ds.Rows = tenantRows(r.Context(), ds.Rows)
+	enc.Encode(ds)
+}
+
+// exportJSON отдаёт текущие данные JSON-массивом строк
+func (s *SearchServer) exportJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="dataset.json"`)
+	json.NewEncoder(w).Encode(tenantRows(r.Context(), s.stored().Rows))
+}
+
+func adminRequest(t *testing.T, method, url, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestAdminReindex(t *testing.T) {
+	ts := NewTestServer(t, WithSearchIndex(), WithManagementToken("admin"))
+	sc := ts.SearchClient("test_token")
+	find := func() []User {
+		t.Helper()
+		resp, err := sc.FindUsers(SearchRequest{Limit: 5, Query: "Reindexed"})
+		require.NoError(t, err)
+		return resp.Users
+	}
+
+	resp, created := userRequest(t, http.MethodPost, ts.URL+"/users", "",
+		`{"FirstName":"Reindexed","LastName":"User","Age":30,"Gender":"female"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Empty(t, find())
+
+	resp = adminRequest(t, http.MethodPost, ts.URL+"/admin/reindex", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = adminRequest(t, http.MethodPost, ts.URL+"/admin/reindex", "admin")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result struct {
+		Status      string `json:"status"`
+		DurationMs  *int64 `json:"duration_ms"`
+		RowsIndexed int    `json:"rows_indexed"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "ok", result.Status)
+	assert.NotNil(t, result.DurationMs)
+	assert.Equal(t, len(dataset.Rows)+1, result.RowsIndexed)
+
+	users := find()
+	require.Len(t, users, 1)
+	assert.Equal(t, created.Id, users[0].Id)
+
+	resp = adminRequest(t, http.MethodGet, ts.URL+"/admin/reindex", "admin")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestAdmin_DisabledWithoutToken(t *testing.T) {
+	ts := NewTestServer(t)
+	resp := adminRequest(t, http.MethodPost, ts.URL+"/admin/reindex", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDatasetExport_RoundTrip(t *testing.T) {
+	ts := NewTestServer(t, WithManagementToken("admin"))
+	resp := adminRequest(t, http.MethodGet, ts.URL+"/dataset.xml", "admin")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got DataSet
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&got))
+	got.Stats = computeFieldStats(got.Rows)
+	assert.Equal(t, dataset, got)
+}
+
+func TestDatasetExport(t *testing.T) {
+	ts := NewTestServer(t, WithManagementToken("admin"))
+	resp, created := userRequest(t, http.MethodPost, ts.URL+"/users", "",
+		`{"FirstName":"Exported","LastName":"User","Age":40,"Gender":"male"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = userRequest(t, http.MethodDelete, ts.URL+"/users/1", "", "")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	download := func(path string) []byte {
+		t.Helper()
+		resp := adminRequest(t, http.MethodGet, ts.URL+path, "admin")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return body
+	}
+
+	var fromXML DataSet
+	require.NoError(t, xml.Unmarshal(download("/dataset.xml"), &fromXML))
+	fromXML.Stats = computeFieldStats(fromXML.Rows)
+	var rows []Row
+	require.NoError(t, json.Unmarshal(download("/dataset.json"), &rows))
+	fromJSON := DataSet{Rows: rows, Stats: computeFieldStats(rows)}
+
+	require.Len(t, fromXML.Rows, len(dataset.Rows)+1)
+	assert.Equal(t, fromXML, fromJSON)
+	last := fromXML.Rows[len(fromXML.Rows)-1]
+	assert.Equal(t, created.Id, last.ID)
+	assert.Equal(t, "Exported", last.FirstName)
+	assert.False(t, fromXML.Rows[1].DeletedAt.IsZero())
+	assert.Equal(t, dataset.Rows[2:], fromXML.Rows[2:len(dataset.Rows)])
+
+	for _, path := range []string{"/dataset.xml", "/dataset.json"} {
+		resp := adminRequest(t, http.MethodGet, ts.URL+path, "")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
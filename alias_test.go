@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldAliases(t *testing.T) {
+	ts := NewTestServer(t, WithFieldAliases(map[string]string{"full_name": "Name", "years": "Age"}))
+	search := func(params url.Values) (int, []User) {
+		t.Helper()
+		params.Set("limit", "25")
+		params.Set("offset", "0")
+		resp, err := http.Get(ts.URL + "/search?" + params.Encode())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var users []User
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&users))
+		}
+		return resp.StatusCode, users
+	}
+
+	code, byName := search(url.Values{"order_field": {"Name"}, "order_by": {"1"}})
+	require.Equal(t, http.StatusOK, code)
+	code, byAlias := search(url.Values{"order_field": {"full_name"}, "order_by": {"1"}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, byName, byAlias)
+
+	_, byCriteria := search(url.Values{"order_by": {"0"}, "order_criteria": {`[{"field":"full_name","dir":1}]`}})
+	assert.Equal(t, byName, byCriteria)
+
+	code, _ = search(url.Values{"order_field": {"nickname"}, "order_by": {"1"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// без алиасов full_name - неизвестное поле
+	plain := NewTestServer(t)
+	resp, err := http.Get(plain.URL + "/search?limit=1&offset=0&order_by=1&order_field=full_name")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
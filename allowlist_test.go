@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// WithAdminAllowlist пускает в ручки /admin/ только с адресов из allowedCIDRs, см. IPAllowlistMiddleware.
+// Проверка адреса идёт до проверки токена. Неверный CIDR - паника прямо при создании опции
+func WithAdminAllowlist(allowedCIDRs ...string) ServerOption {
+	allowlist := IPAllowlistMiddleware(allowedCIDRs)
+	return func(s *SearchServer) {
+		s.adminAllowlist = allowlist
+	}
+}
+
+// IPAllowlistMiddleware отвечает 403 на запросы с адресов не из allowedCIDRs.
+// Кроме сетей вида 10.0.0.0/8 можно указывать и отдельные адреса.
+// X-Real-IP учитывается, только если соединение пришло с разрешённого адреса, то есть от своего прокси:
+// иначе любой мог бы подставить в заголовок доверенный адрес
+func IPAllowlistMiddleware(allowedCIDRs []string) Middleware {
+	nets := make([]*net.IPNet, 0, len(allowedCIDRs))
+	for _, cidr := range allowedCIDRs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				panic(fmt.Sprintf("invalid allowlist address %q", cidr))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("invalid allowlist CIDR %q: %s", cidr, err))
+		}
+		nets = append(nets, n)
+	}
+	allowed := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		for _, n := range nets {
+			if ip != nil && n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				peer = r.RemoteAddr
+			}
+			ok := allowed(peer)
+			if real := r.Header.Get("X-Real-IP"); ok && real != "" {
+				ok = allowed(strings.TrimSpace(real))
+			}
+			if !ok {
+				writeError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestIPAllowlistMiddleware(t *testing.T) {
+	h := IPAllowlistMiddleware([]string{"192.168.1.10", "10.0.0.0/8", "2001:db8::/32"})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := func(remoteAddr, realIP string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/reindex", nil)
+		req.RemoteAddr = remoteAddr
+		if realIP != "" {
+			req.Header.Set("X-Real-IP", realIP)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, tt := range []struct {
+		remoteAddr, realIP string
+		want               int
+	}{
+		{"192.168.1.10:5000", "", http.StatusOK},
+		{"192.168.1.11:5000", "", http.StatusForbidden},
+		{"10.20.30.40:5000", "", http.StatusOK},
+		{"11.0.0.1:5000", "", http.StatusForbidden},
+		{"[2001:db8::1]:5000", "", http.StatusOK},
+		{"[2001:db9::1]:5000", "", http.StatusForbidden},
+		{"garbage", "", http.StatusForbidden},
+		// за своим прокси решает адрес клиента из X-Real-IP
+		{"10.0.0.1:5000", "192.168.1.10", http.StatusOK},
+		{"10.0.0.1:5000", "8.8.8.8", http.StatusForbidden},
+		// чужой не может выдать себя за доверенный адрес
+		{"8.8.8.8:5000", "10.0.0.1", http.StatusForbidden},
+	} {
+		assert.Equal(t, tt.want, status(tt.remoteAddr, tt.realIP), "%s via %q", tt.remoteAddr, tt.realIP)
+	}
+
+	assert.PanicsWithValue(t, `invalid allowlist address "10.0.0"`, func() { IPAllowlistMiddleware([]string{"10.0.0"}) })
+	assert.Panics(t, func() { IPAllowlistMiddleware([]string{"10.0.0.0/33"}) })
+}
+
+func TestAdminAllowlist(t *testing.T) {
+	s := NewSearchServer(WithManagementToken("admin"), WithAdminAllowlist("10.0.0.0/8"))
+	status := func(method, path, remoteAddr, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, route := range [][2]string{
+		{http.MethodPost, "/admin/reindex"}, {http.MethodPatch, "/admin/config"}, {http.MethodPost, "/admin/import"},
+	} {
+		assert.Equal(t, http.StatusForbidden, status(route[0], route[1], "8.8.8.8:1234", "admin"), route[1])
+		assert.Equal(t, http.StatusUnauthorized, status(route[0], route[1], "10.1.2.3:1234", ""), route[1])
+	}
+	assert.Equal(t, http.StatusOK, status(http.MethodPost, "/admin/reindex", "10.1.2.3:1234", "admin"))
+	// поиск ограничение не трогает
+	assert.Equal(t, http.StatusOK, status(http.MethodGet, "/?limit=1&offset=0&order_by=0", "8.8.8.8:1234", ""))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// сколько самых частых слов профиля идёт в запрос SearchAround
+const aroundTokens = 3
+
+// слова, по которым искать похожих бессмысленно, слова короче трёх букв отбрасываются и так
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+	"from": true, "are": true, "was": true, "not": true, "but": true,
+	"est": true, "qui": true, "sit": true, "non": true, "sed": true,
+}
+
+// SearchAround ищет пользователей, похожих на userID: берёт 3 самых частых слова из его Name и About
+// и ищет любое из них (Queries), сам userID в выдачу не попадает.
+// Из req используются Limit, Offset, сортировка и фильтры, Query и Queries перезаписываются
+func (srv *SearchClient) SearchAround(ctx context.Context, userID int, req SearchRequest) (*SearchResponse, error) {
+	ref, err := srv.FindUserByID(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Query = ""
+	req.Queries = topTokens(ref.Name+" "+ref.About, aroundTokens)
+	limit := req.Limit
+	req.Limit++
+	resp, err := srv.Do(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]User, 0, len(resp.Users))
+	for _, u := range resp.Users {
+		if u.Id != userID {
+			users = append(users, u)
+		}
+	}
+	if len(users) > limit {
+		users = users[:limit]
+		resp.NextPage = true
+	}
+	resp.Users = users
+	return resp, nil
+}
+
+// topTokens возвращает n самых частых слов text в нижнем регистре, при равенстве - по алфавиту
+func topTokens(text string, n int) []string {
+	counts := map[string]int{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if len([]rune(w)) < 3 || stopwords[w] {
+			continue
+		}
+		counts[w]++
+	}
+
+	words := make([]string, 0, len(counts))
+	for w := range counts {
+		words = append(words, w)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > n {
+		words = words[:n]
+	}
+	return words
+}
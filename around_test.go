@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopTokens(t *testing.T) {
+	assert.Equal(t, []string{"nulla", "dolor", "amet"},
+		topTokens("Nulla nulla, dolor DOLOR sit amet ut nulla est. Zeta.", 3))
+	assert.Empty(t, topTokens("ut a do", 3))
+}
+
+func TestSearchAround(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	ref, err := sc.FindUserByID(context.Background(), 0, false)
+	require.NoError(t, err)
+
+	resp, err := sc.SearchAround(context.Background(), 0, SearchRequest{Limit: 5, OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Users)
+	assert.LessOrEqual(t, len(resp.Users), 5)
+	for _, u := range resp.Users {
+		assert.NotEqual(t, ref.Id, u.Id)
+	}
+
+	require.Len(t, ts.received, 1)
+	sent := ts.received[0]
+	assert.Empty(t, sent.Query)
+	require.Len(t, sent.Queries, aroundTokens)
+	profile := strings.ToLower(ref.Name + " " + ref.About)
+	for _, q := range sent.Queries {
+		assert.Contains(t, profile, q)
+	}
+
+	_, err = sc.SearchAround(context.Background(), 100500, SearchRequest{Limit: 5})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// AuditLogger получает каждый поисковый запрос, токен - только в виде sha256
+type AuditLogger interface {
+	LogQuery(timestamp time.Time, tokenHash string, params url.Values)
+}
+
+// NoOpAuditLogger ничего не пишет
+type NoOpAuditLogger struct{}
+
+func (NoOpAuditLogger) LogQuery(time.Time, string, url.Values) {}
+
+type auditRecord struct {
+	Timestamp time.Time  `json:"timestamp"`
+	TokenHash string     `json:"token_hash"`
+	Params    url.Values `json:"params"`
+}
+
+type fileAuditLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// FileAuditLogger пишет в w по JSON-строке на запрос
+func FileAuditLogger(w io.Writer) AuditLogger {
+	return &fileAuditLogger{w: w}
+}
+
+func (l *fileAuditLogger) LogQuery(timestamp time.Time, tokenHash string, params url.Values) {
+	line, _ := json.Marshal(auditRecord{Timestamp: timestamp, TokenHash: tokenHash, Params: params})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(line, '\n'))
+}
+
+// AuditMiddleware синхронно отдаёт logger параметры запроса (и из урла, и из формы в теле) до обработчика.
+// Сырой AccessToken никуда не пишется, пустой токен логируется пустой строкой
+func AuditMiddleware(logger AuditLogger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			params := r.URL.Query()
+			if err := r.ParseForm(); err == nil {
+				params = r.Form
+			}
+			logger.LogQuery(time.Now().UTC(), hashToken(r.Header.Get("AccessToken")), params)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hashToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	ts := httptest.NewServer(AuditMiddleware(FileAuditLogger(&buf))(NewSearchServer()))
+	defer ts.Close()
+
+	sc := &SearchClient{AccessToken: "super-secret", URL: ts.URL}
+	_, err := sc.FindUsers(SearchRequest{Limit: 1, Query: "Boyd"})
+	require.NoError(t, err)
+	resp, err := http.PostForm(ts.URL+"/search?limit=1", url.Values{"offset": {"0"}, "order_by": {"0"}, "query": {"Wolf"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.NotContains(t, buf.String(), "super-secret")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var first, second auditRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	sum := sha256.Sum256([]byte("super-secret"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), first.TokenHash)
+	assert.Equal(t, "Boyd", first.Params.Get("query"))
+	assert.Equal(t, "2", first.Params.Get("limit"))
+	assert.WithinDuration(t, time.Now(), first.Timestamp, time.Minute)
+	assert.Empty(t, second.TokenHash)
+	assert.Equal(t, "Wolf", second.Params.Get("query"))
+	assert.Equal(t, "1", second.Params.Get("limit"))
+
+	rec := httptest.NewRecorder()
+	AuditMiddleware(NoOpAuditLogger{})(NewSearchServer()).ServeHTTP(rec,
+		httptest.NewRequest(http.MethodGet, "/search?limit=1&offset=0&order_by=0", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// больше за один вызов /admin/benchmark не гоняем, чтобы не положить сервер
+const maxBenchmarkIterations = 10000
+
+type BenchmarkResult struct {
+	Iterations int   `json:"iterations"`
+	MinNs      int64 `json:"min_ns"`
+	MaxNs      int64 `json:"max_ns"`
+	MeanNs     int64 `json:"mean_ns"`
+	P99Ns      int64 `json:"p99_ns"`
+	// строк датасета, просмотренных поиском за секунду
+	RowsPerSec  float64 `json:"rows_per_sec"`
+	BytesPerOp  uint64  `json:"bytes_per_op"`
+	AllocsPerOp uint64  `json:"allocs_per_op"`
+}
+
+// Benchmark гоняет поиск req внутри процесса, без сети, iterations раз.
+// Отмена ctx останавливает прогон, тогда Iterations меньше запрошенного
+func (s *SearchServer) Benchmark(ctx context.Context, req SearchRequest, iterations int) BenchmarkResult {
+	target := "/search?" + req.values().Encode()
+	rows := len(s.data().Rows)
+	timings := make([]int64, 0, iterations)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < iterations && ctx.Err() == nil; i++ {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		start := time.Now()
+		s.search(httptest.NewRecorder(), r)
+		timings = append(timings, time.Since(start).Nanoseconds())
+	}
+	runtime.ReadMemStats(&after)
+
+	res := BenchmarkResult{Iterations: len(timings)}
+	if len(timings) == 0 {
+		return res
+	}
+	var total int64
+	for _, ns := range timings {
+		total += ns
+	}
+	sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+	res.MinNs = timings[0]
+	res.MaxNs = timings[len(timings)-1]
+	res.MeanNs = total / int64(len(timings))
+	res.P99Ns = timings[(len(timings)*99-1)/100]
+	if total > 0 {
+		res.RowsPerSec = float64(rows*len(timings)) / time.Duration(total).Seconds()
+	}
+	res.BytesPerOp = (after.TotalAlloc - before.TotalAlloc) / uint64(len(timings))
+	res.AllocsPerOp = (after.Mallocs - before.Mallocs) / uint64(len(timings))
+	return res
+}
+
+type benchmarkRequest struct {
+	Request    SearchRequest `json:"request"`
+	Iterations int           `json:"iterations"`
+}
+
+func (s *SearchServer) benchmark(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var in benchmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "cant unpack benchmark request")
+		return
+	}
+	if in.Iterations <= 0 || in.Iterations > maxBenchmarkIterations {
+		writeError(w, http.StatusBadRequest, "iterations must be in 1..10000")
+		return
+	}
+	if err := in.Request.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// прогоняем один раз заранее, чтобы кривой запрос не мерить
+	probe := httptest.NewRecorder()
+	s.search(probe, httptest.NewRequest(http.MethodGet, "/search?"+in.Request.values().Encode(), nil))
+	if probe.Code != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(probe.Code)
+		io.Copy(w, probe.Body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Benchmark(r.Context(), in.Request, in.Iterations))
+}
+
+func TestAdminBenchmark(t *testing.T) {
+	ts := NewTestServer(t, WithManagementToken("admin"))
+	post := func(token, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/admin/benchmark", strings.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := post("admin", `{"request": {"Limit": 10, "Query": "nulla", "OrderField": "Age", "OrderBy": 1}, "iterations": 50}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var res BenchmarkResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, 50, res.Iterations)
+	assert.LessOrEqual(t, res.MinNs, res.MeanNs)
+	assert.LessOrEqual(t, res.MeanNs, res.MaxNs)
+	assert.LessOrEqual(t, res.P99Ns, res.MaxNs)
+	assert.Greater(t, res.RowsPerSec, 0.0)
+
+	for body, want := range map[string]int{
+		`{"request": {"Limit": 1}, "iterations": 0}`:                        http.StatusBadRequest,
+		`{"request": {"Limit": 1, "OrderField": "About"}, "iterations": 1}`: http.StatusBadRequest,
+		`not json`: http.StatusBadRequest,
+	} {
+		resp := post("admin", body)
+		resp.Body.Close()
+		assert.Equal(t, want, resp.StatusCode, body)
+	}
+
+	resp = post("", `{"request": {"Limit": 1}, "iterations": 1}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestBenchmark_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := NewSearchServer().Benchmark(ctx, SearchRequest{Limit: 1}, 10)
+	assert.Equal(t, BenchmarkResult{}, res)
+}
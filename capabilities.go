@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var ErrCapabilityNotSupported = errors.New("capability not supported by server")
+
+// ServerCapabilities - что умеет сервер, отдаётся GET /capabilities
+type ServerCapabilities struct {
+	SupportsFuzzySearch bool `json:"supports_fuzzy_search"`
+	SupportsFullText    bool `json:"supports_full_text"`
+	// 0 - без ограничения
+	MaxLimit            int      `json:"max_limit"`
+	SupportedQueryModes []string `json:"supported_query_modes"`
+	SupportsStreaming   bool     `json:"supports_streaming"`
+}
+
+// GetCapabilities спрашивает сервер, что он умеет. Ответ запоминается на всё время жизни клиента
+func (srv *SearchClient) GetCapabilities(ctx context.Context) (*ServerCapabilities, error) {
+	srv.mu.RLock()
+	caps := srv.caps
+	srv.mu.RUnlock()
+	if caps != nil {
+		return caps, nil
+	}
+
+	resp, body, err := srv.send(ctx, http.MethodGet, srv.endpoint("/capabilities"), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("capabilities request failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	caps = &ServerCapabilities{}
+	if err := json.Unmarshal(body, caps); err != nil {
+		return nil, fmt.Errorf("cant unpack capabilities json: %s", err)
+	}
+	srv.mu.Lock()
+	srv.caps = caps
+	srv.mu.Unlock()
+	return caps, nil
+}
+
+// checkCapabilities не пускает на сервер запросы с возможностями, которых у него нет.
+// Сервер, не знающий /capabilities, считается не умеющим ничего дополнительного
+func (srv *SearchClient) checkCapabilities(ctx context.Context, req SearchRequest) error {
+	if req.FuzzyDistance == 0 {
+		return nil
+	}
+	caps, err := srv.GetCapabilities(ctx)
+	if err != nil || !caps.SupportsFuzzySearch {
+		return fmt.Errorf("%w: fuzzy search", ErrCapabilityNotSupported)
+	}
+	return nil
+}
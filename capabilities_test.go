@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *SearchServer) capabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ServerCapabilities{
+		SupportedQueryModes: []string{"substring", "any", "not"},
+	})
+}
+
+func TestGetCapabilities(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	caps, err := sc.GetCapabilities(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &ServerCapabilities{SupportedQueryModes: []string{"substring", "any", "not"}}, caps)
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, Query: "Boyd", FuzzyDistance: 1})
+	assert.ErrorIs(t, err, ErrCapabilityNotSupported)
+	assert.Empty(t, ts.received, "unsupported request must not reach the server")
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, FuzzyDistance: -1})
+	require.Error(t, err)
+}
+
+func TestGetCapabilities_Cached(t *testing.T) {
+	var calls atomic.Int32
+	srv := NewSearchServer()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/capabilities":
+			calls.Add(1)
+			json.NewEncoder(w).Encode(ServerCapabilities{SupportsFuzzySearch: true})
+		default:
+			assert.Equal(t, "1", r.FormValue("fuzzy_distance"))
+			srv.ServeHTTP(w, r)
+		}
+	}))
+	defer ts.Close()
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+
+	for i := 0; i < 3; i++ {
+		_, err := sc.FindUsers(SearchRequest{Limit: 1, Query: "Boyd", FuzzyDistance: 1})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	old := httptest.NewServer(http.NotFoundHandler())
+	defer old.Close()
+	sc = &SearchClient{AccessToken: "test_token", URL: old.URL}
+	_, err := sc.GetCapabilities(context.Background())
+	require.Error(t, err)
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, FuzzyDistance: 2})
+	assert.ErrorIs(t, err, ErrCapabilityNotSupported)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ChangeEntry struct {
+	// порядковый номер изменения, растёт в том же порядке, в каком изменения сохранялись
+	Seq       uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	Operation string    `json:"operation"`
+	UserID    int       `json:"user_id"`
+	// sha256 от AccessToken, как в аудите: журнал отдаётся без авторизации
+	ActorTokenHash string `json:"actor_token_hash"`
+	Before         *User  `json:"before"`
+	After          *User  `json:"after"`
+}
+
+// сколько последних изменений помнит журнал
+const changeLogSize = 10000
+
+// changeLog только дописывается, записи после добавления не меняются.
+// Это кольцо: после changeLogSize записей самые старые вытесняются
+type changeLog struct {
+	mu      sync.RWMutex
+	entries []ChangeEntry
+	// куда писать следующую запись, когда кольцо заполнено
+	next int
+	// Seq последней записи
+	seq uint64
+}
+
+// append дописывает изменение и возвращает получившуюся запись
+func (l *changeLog) append(op string, r *http.Request, before, after *Row) ChangeEntry {
+	e := ChangeEntry{
+		Timestamp:      time.Now().UTC(),
+		Operation:      op,
+		ActorTokenHash: hashToken(r.Header.Get("AccessToken")),
+	}
+	if before != nil {
+		u := rowToUser(*before)
+		e.Before = &u
+		e.UserID = before.ID
+	}
+	if after != nil {
+		u := rowToUser(*after)
+		e.After = &u
+		e.UserID = after.ID
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	if len(l.entries) < changeLogSize {
+		l.entries = append(l.entries, e)
+		return e
+	}
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % changeLogSize
+	return e
+}
+
+// list возвращает копии записей, userID < 0 - по всем пользователям
+func (l *changeLog) list(userID int, since time.Time, limit int) []ChangeEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := []ChangeEntry{}
+	// от старых к новым: хвост кольца после next старше его начала
+	ordered := append(append([]ChangeEntry(nil), l.entries[l.next:]...), l.entries[:l.next]...)
+	for _, e := range ordered {
+		if len(out) >= limit {
+			break
+		}
+		if userID >= 0 && e.UserID != userID {
+			continue
+		}
+		if e.Timestamp.Before(since) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+const defaultChangelogLimit = 100
+
+func (s *SearchServer) changelogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := -1
+	if v := r.FormValue("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			writeError(w, http.StatusBadRequest, "invalid user_id")
+			return
+		}
+		userID = id
+	}
+	var since time.Time
+	if v := r.FormValue("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since")
+			return
+		}
+		since = t
+	}
+	limit := defaultChangelogLimit
+	if v := r.FormValue("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = l
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.changelog.list(userID, since, limit))
+}
+
+func TestChangelog(t *testing.T) {
+	ts := NewTestServer(t)
+	start := time.Now().UTC()
+
+	resp, created := userRequest(t, http.MethodPost, ts.URL+"/users", "",
+		`{"FirstName":"New","LastName":"User","Age":20,"Gender":"male"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, len(dataset.Rows), created.Id)
+	id := strconv.Itoa(created.Id)
+
+	resp, patched := userRequest(t, http.MethodPatch, ts.URL+"/users/"+id, resp.Header.Get("ETag"), `{"Age": 21}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = userRequest(t, http.MethodDelete, ts.URL+"/users/"+id, "", "")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = userRequest(t, http.MethodGet, ts.URL+"/users/1", "", "")
+	resp, _ = userRequest(t, http.MethodPatch, ts.URL+"/users/1", resp.Header.Get("ETag"), `{"Age": 1}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	get := func(params string) []ChangeEntry {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/changelog?" + params)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var entries []ChangeEntry
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+		return entries
+	}
+
+	entries := get("user_id=" + id)
+	require.Len(t, entries, 3)
+	ops := []string{}
+	for _, e := range entries {
+		ops = append(ops, e.Operation)
+		assert.Equal(t, created.Id, e.UserID)
+		assert.False(t, e.Timestamp.Before(start))
+	}
+	assert.Equal(t, []string{"create", "patch", "delete"}, ops)
+	assert.Nil(t, entries[0].Before)
+	assert.Equal(t, created, *entries[0].After)
+	assert.Equal(t, created, *entries[1].Before)
+	assert.Equal(t, patched, *entries[1].After)
+	assert.Equal(t, patched, *entries[2].Before)
+
+	assert.Len(t, get(""), 4)
+	assert.Len(t, get("limit=2"), 2)
+	assert.Empty(t, get("since="+time.Now().Add(time.Hour).Format(time.RFC3339)))
+	assert.Len(t, get("user_id=1&since="+start.Format(time.RFC3339Nano)), 1)
+
+	for _, bad := range []string{"user_id=x", "since=yesterday", "limit=0"} {
+		resp, err := http.Get(ts.URL + "/changelog?" + bad)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, bad)
+	}
+
+	resp, err := http.Post(ts.URL+"/changelog", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestChangelog_ConcurrentOrder(t *testing.T) {
+	ts := NewTestServer(t)
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := userRequest(t, http.MethodPost, ts.URL+"/users", "", `{"FirstName":"New"}`)
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		}()
+	}
+	wg.Wait()
+
+	resp, err := http.Get(ts.URL + "/changelog?limit=" + strconv.Itoa(n))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var entries []ChangeEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(t, entries, n)
+	// id выдаются по порядку сохранения, в том же порядке должен идти и журнал
+	for i, e := range entries {
+		assert.Equal(t, uint64(i+1), e.Seq)
+		assert.Equal(t, len(dataset.Rows)+i, e.UserID)
+		if i > 0 {
+			assert.False(t, e.Timestamp.Before(entries[i-1].Timestamp))
+		}
+	}
+}
+
+func TestChangeLog_HashAndEviction(t *testing.T) {
+	var l changeLog
+	r := httptest.NewRequest(http.MethodPatch, "/users/1", nil)
+	r.Header.Set("AccessToken", "secret-token")
+	for i := 0; i < changeLogSize+5; i++ {
+		l.append("patch", r, nil, &Row{ID: i})
+	}
+
+	entries := l.list(-1, time.Time{}, changeLogSize+10)
+	require.Len(t, entries, changeLogSize)
+	assert.Equal(t, 5, entries[0].UserID, "oldest entries are evicted")
+	assert.Equal(t, uint64(6), entries[0].Seq)
+	assert.Equal(t, changeLogSize+4, entries[len(entries)-1].UserID)
+	assert.Equal(t, hashToken("secret-token"), entries[0].ActorTokenHash)
+
+	body, err := json.Marshal(entries[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "secret-token")
+}
+
+func TestCreateUser_Errors(t *testing.T) {
+	ts := NewTestServer(t)
+	resp, _ := userRequest(t, http.MethodPost, ts.URL+"/users", "", `{"Id": 5}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = userRequest(t, http.MethodGet, ts.URL+"/users", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
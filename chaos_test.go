@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ChaosMiddleware задерживает ответы и отвечает 500 с вероятностью errorRate, чтобы проверять ретраи и таймауты клиента.
+// Задержка - сдвинутое экспоненциальное распределение с медианой latencyP50 и 99-м перцентилем latencyP99.
+// Работает только при CHAOS_MODE=1 на момент создания, иначе запросы проходят как есть
+func ChaosMiddleware(latencyP50, latencyP99 time.Duration, errorRate float64, rng *rand.Rand) Middleware {
+	if os.Getenv("CHAOS_MODE") != "1" {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	var mu sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// rand.Rand не потокобезопасен
+			mu.Lock()
+			delay := chaosDelay(latencyP50, latencyP99, rng)
+			fail := rng.Float64() < errorRate
+			mu.Unlock()
+
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			if fail {
+				writeError(w, http.StatusInternalServerError, "chaos")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// chaosDelay подбирает сдвиг и интенсивность экспоненты так, чтобы медиана и p99 совпали с заданными
+func chaosDelay(p50, p99 time.Duration, rng *rand.Rand) time.Duration {
+	if p99 <= p50 {
+		return p50
+	}
+	mean := float64(p99-p50) / (math.Log(100) - math.Log(2))
+	shift := float64(p50) - math.Log(2)*mean
+	d := shift + rng.ExpFloat64()*mean
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d)
+}
+
+func TestChaosMiddleware_Errors(t *testing.T) {
+	t.Setenv("CHAOS_MODE", "1")
+	h := ChaosMiddleware(0, 0, 1, rand.New(rand.NewSource(1)))(NewSearchServer())
+	for i := 0; i < 20; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?limit=1&offset=0&order_by=0", nil))
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+	}
+
+	h = ChaosMiddleware(0, 0, 0, rand.New(rand.NewSource(1)))(NewSearchServer())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?limit=1&offset=0&order_by=0", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestChaosMiddleware_DisabledWithoutEnv(t *testing.T) {
+	t.Setenv("CHAOS_MODE", "")
+	h := ChaosMiddleware(time.Hour, time.Hour, 1, rand.New(rand.NewSource(1)))(NewSearchServer())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?limit=1&offset=0&order_by=0", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestChaosMiddleware_ClientTimeout(t *testing.T) {
+	t.Setenv("CHAOS_MODE", "1")
+	ts := httptest.NewServer(ChaosMiddleware(200*time.Millisecond, 200*time.Millisecond, 0, rand.New(rand.NewSource(1)))(NewSearchServer()))
+	defer ts.Close()
+
+	sc, err := NewSearchClient(ts.URL, "test_token", WithTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout")
+}
+
+func TestChaosDelay_Percentiles(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	p50, p99 := 10*time.Millisecond, 100*time.Millisecond
+	samples := make([]time.Duration, 20000)
+	for i := range samples {
+		samples[i] = chaosDelay(p50, p99, rng)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	assert.InDelta(t, float64(p50), float64(samples[len(samples)/2]), float64(2*time.Millisecond))
+	assert.InDelta(t, float64(p99), float64(samples[len(samples)*99/100]), float64(15*time.Millisecond))
+	assert.Equal(t, p50, chaosDelay(p50, p50, rng))
+}
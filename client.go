@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/propagation"
 )
 
 var (
@@ -23,11 +31,150 @@ type User struct {
 	Age    int
 	About  string
 	Gender string
+	// релевантность, сервер заполняет только при сортировке по Score. В MarshalText не входит
+	Score float64 `json:",omitempty"`
+}
+
+// MarshalText кодирует пользователя в стабильную строку вида About=...&Age=...&Gender=...&Id=...&Name=...,
+// чтобы User можно было использовать как ключ в map при сериализации и хранить как строку
+func (u User) MarshalText() ([]byte, error) {
+	v := url.Values{}
+	v.Set("Id", strconv.Itoa(u.Id))
+	v.Set("Name", u.Name)
+	v.Set("Age", strconv.Itoa(u.Age))
+	v.Set("About", u.About)
+	v.Set("Gender", u.Gender)
+	return []byte(v.Encode()), nil
+}
+
+func (u *User) UnmarshalText(text []byte) error {
+	v, err := url.ParseQuery(string(text))
+	if err != nil {
+		return fmt.Errorf("cant parse user text: %s", err)
+	}
+	res := User{
+		Name:   v.Get("Name"),
+		About:  v.Get("About"),
+		Gender: v.Get("Gender"),
+	}
+	if res.Id, err = strconv.Atoi(v.Get("Id")); err != nil {
+		return fmt.Errorf("bad user Id: %s", err)
+	}
+	if res.Age, err = strconv.Atoi(v.Get("Age")); err != nil {
+		return fmt.Errorf("bad user Age: %s", err)
+	}
+	*u = res
+	return nil
+}
+
+// без этого encoding/json увидел бы MarshalText и стал кодировать User строкой, а не объектом
+type userJSON User
+
+func (u User) MarshalJSON() ([]byte, error) {
+	return json.Marshal(userJSON(u))
+}
+
+func (u *User) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*userJSON)(u))
+}
+
+// Sanitize возвращает копию для логов: About скрыт, от имени остаются инициал и фамилия ("Boyd Wolf" -> "B. Wolf")
+func (u User) Sanitize() User {
+	u.About = "<redacted>"
+	parts := strings.Fields(u.Name)
+	switch len(parts) {
+	case 0:
+		u.Name = ""
+	case 1:
+		u.Name = string([]rune(parts[0])[:1]) + "."
+	default:
+		u.Name = string([]rune(parts[0])[:1]) + ". " + parts[len(parts)-1]
+	}
+	return u
+}
+
+// UserValidationError перечисляет всё, что не так с пользователем, см. User.Validate
+type UserValidationError struct {
+	Id         int
+	Violations []string
+}
+
+func (e *UserValidationError) Error() string {
+	return fmt.Sprintf("invalid user %d: %s", e.Id, strings.Join(e.Violations, "; "))
+}
+
+const maxUserAge = 150
+
+// Validate проверяет, что пришедший от сервера пользователь похож на правду.
+// Id 0 допустим - с него нумеруется датасет
+func (u User) Validate() error {
+	var violations []string
+	if u.Id < 0 {
+		violations = append(violations, "id must be >= 0")
+	}
+	if u.Name == "" {
+		violations = append(violations, "name is empty")
+	}
+	if u.Age < 0 || u.Age > maxUserAge {
+		violations = append(violations, fmt.Sprintf("age must be in [0, %d], got %d", maxUserAge, u.Age))
+	}
+	switch Gender(u.Gender) {
+	case GenderMale, GenderFemale:
+	default:
+		violations = append(violations, fmt.Sprintf("unknown gender %q", u.Gender))
+	}
+	if len(violations) > 0 {
+		return &UserValidationError{Id: u.Id, Violations: violations}
+	}
+	return nil
 }
 
 type SearchResponse struct {
 	Users    []User
 	NextPage bool
+	// сколько всего пользователей подошло под запрос, без учёта limit/offset.
+	// Берётся из заголовка X-Total-Count, если сервер его не прислал - 0
+	TotalCount int
+	// X-Request-ID из ответа сервера, чтобы можно было найти запрос в его логах
+	RequestID string
+	// что сервер делал с запросом, заполняется только при SearchRequest.Debug
+	Debug map[string]interface{}
+}
+
+// clone копирует ответ так, чтобы правка пользователей в копии не задевала оригинал
+func (resp *SearchResponse) clone() *SearchResponse {
+	c := *resp
+	c.Users = append([]User(nil), resp.Users...)
+	return &c
+}
+
+// Equal сравнивает ответы, порядок пользователей не важен - они сопоставляются по Id
+func (resp SearchResponse) Equal(other SearchResponse) bool {
+	if resp.NextPage != other.NextPage || resp.TotalCount != other.TotalCount {
+		return false
+	}
+	if len(resp.Users) != len(other.Users) {
+		return false
+	}
+	byID := make(map[int][]User, len(resp.Users))
+	for _, u := range resp.Users {
+		byID[u.Id] = append(byID[u.Id], u)
+	}
+	for _, u := range other.Users {
+		candidates := byID[u.Id]
+		found := -1
+		for i, c := range candidates {
+			if c == u {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return false
+		}
+		byID[u.Id] = append(candidates[:found], candidates[found+1:]...)
+	}
+	return true
 }
 
 type SearchErrorResponse struct {
@@ -42,12 +189,190 @@ const (
 	ErrorBadOrderField = `OrderField invalid`
 )
 
+type Gender string
+
+const (
+	GenderMale   Gender = "male"
+	GenderFemale Gender = "female"
+)
+
 type SearchRequest struct {
 	Limit      int
-	Offset     int    // Можно учесть после сортировки
-	Query      string // подстрока в 1 из полей
+	Offset     int      // Можно учесть после сортировки
+	Query      string   // подстрока в 1 из полей
+	NotQuery   string   // подстрока, которой в полях быть не должно
+	Queries    []string // дополнительные подстроки, достаточно совпадения с любой (или с Query)
 	OrderField string
 	OrderBy    int
+	Gender     Gender // пустой - без фильтра по полу
+	// по умолчанию удалённые (DELETE /users/{id}) пользователи в выдачу не попадают
+	IncludeDeleted bool
+	// попросить сервер рассказать, как он выполнял запрос, см. SearchResponse.Debug
+	Debug bool
+	// какие поля пользователей оставить в ответе, пустой - все
+	Fields []UserField
+	// только пользователи с Id > SinceID, вместе с сортировкой по Id - лента новых пользователей
+	SinceID int
+	// допустимое число опечаток в Query, работает только если сервер умеет нечёткий поиск, см. GetCapabilities
+	FuzzyDistance int
+	// при OrderField == "Score" отбросить пользователей с меньшей релевантностью, иначе не используется
+	MinScore float64
+	// если > 0, сервер отдаёт случайную выборку такого размера из отфильтрованных пользователей,
+	// сортировка и пагинация применяются уже к ней
+	RandomSample int
+	// зерно для RandomSample, одинаковое зерно - одинаковая выборка; 0 - сервер берёт текущее время
+	Seed int64
+	// keyset-пагинация: только Id > AfterID (следующая страница) и/или Id < BeforeID (предыдущая).
+	// Работает только с OrderField == "Id", 0 - не задано
+	AfterID  int
+	BeforeID int
+}
+
+// mergeOver заполняет незаданные (нулевые) поля req значениями из def
+func (req SearchRequest) mergeOver(def SearchRequest) SearchRequest {
+	if req.Limit == 0 {
+		req.Limit = def.Limit
+	}
+	if req.Offset == 0 {
+		req.Offset = def.Offset
+	}
+	if req.Query == "" {
+		req.Query = def.Query
+	}
+	if req.NotQuery == "" {
+		req.NotQuery = def.NotQuery
+	}
+	if req.Queries == nil {
+		req.Queries = def.Queries
+	}
+	if req.OrderField == "" {
+		req.OrderField = def.OrderField
+	}
+	if req.OrderBy == OrderByAsIs {
+		req.OrderBy = def.OrderBy
+	}
+	if req.Gender == "" {
+		req.Gender = def.Gender
+	}
+	if !req.IncludeDeleted {
+		req.IncludeDeleted = def.IncludeDeleted
+	}
+	if !req.Debug {
+		req.Debug = def.Debug
+	}
+	if req.Fields == nil {
+		req.Fields = def.Fields
+	}
+	if req.SinceID == 0 {
+		req.SinceID = def.SinceID
+	}
+	if req.FuzzyDistance == 0 {
+		req.FuzzyDistance = def.FuzzyDistance
+	}
+	if req.MinScore == 0 {
+		req.MinScore = def.MinScore
+	}
+	if req.RandomSample == 0 {
+		req.RandomSample = def.RandomSample
+	}
+	if req.Seed == 0 {
+		req.Seed = def.Seed
+	}
+	if req.AfterID == 0 {
+		req.AfterID = def.AfterID
+	}
+	if req.BeforeID == 0 {
+		req.BeforeID = def.BeforeID
+	}
+	return req
+}
+
+// values - параметры запроса к серверу, limit уходит как есть
+func (req SearchRequest) values() url.Values {
+	params := url.Values{}
+	params.Add("limit", strconv.Itoa(req.Limit))
+	params.Add("offset", strconv.Itoa(req.Offset))
+	params.Add("query", req.Query)
+	for _, q := range req.Queries {
+		params.Add("queries", q)
+	}
+	if req.NotQuery != "" {
+		params.Add("not_query", req.NotQuery)
+	}
+	if req.Gender != "" {
+		params.Add("gender", string(req.Gender))
+	}
+	if req.IncludeDeleted {
+		params.Add("include_deleted", "true")
+	}
+	if req.Debug {
+		params.Add("debug", "true")
+	}
+	if req.SinceID > 0 {
+		params.Add("since_id", strconv.Itoa(req.SinceID))
+	}
+	for _, f := range req.Fields {
+		params.Add("fields", string(f))
+	}
+	if req.FuzzyDistance > 0 {
+		params.Add("fuzzy_distance", strconv.Itoa(req.FuzzyDistance))
+	}
+	if req.MinScore > 0 {
+		params.Add("min_score", strconv.FormatFloat(req.MinScore, 'f', -1, 64))
+	}
+	if req.RandomSample > 0 {
+		params.Add("random_sample", strconv.Itoa(req.RandomSample))
+	}
+	if req.Seed != 0 {
+		params.Add("seed", strconv.FormatInt(req.Seed, 10))
+	}
+	if req.AfterID > 0 {
+		params.Add("after_id", strconv.Itoa(req.AfterID))
+	}
+	if req.BeforeID > 0 {
+		params.Add("before_id", strconv.Itoa(req.BeforeID))
+	}
+	params.Add("order_field", req.OrderField)
+	params.Add("order_by", strconv.Itoa(req.OrderBy))
+	return params
+}
+
+// ValidateOrderBy проверяет, что ob - одна из констант OrderByAsc, OrderByAsIs, OrderByDesc
+func ValidateOrderBy(ob int) error {
+	switch ob {
+	case OrderByAsc, OrderByAsIs, OrderByDesc:
+		return nil
+	}
+	return fmt.Errorf("invalid order_by value: %d", ob)
+}
+
+// Validate проверяет запрос до отправки на сервер
+func (req SearchRequest) Validate() error {
+	if req.Limit < 0 {
+		return fmt.Errorf("limit must be > 0")
+	}
+	if req.Offset < 0 {
+		return fmt.Errorf("offset must be > 0")
+	}
+	if req.SinceID < 0 {
+		return fmt.Errorf("since_id must be >= 0")
+	}
+	if req.FuzzyDistance < 0 {
+		return fmt.Errorf("fuzzy_distance must be >= 0")
+	}
+	if req.MinScore < 0 {
+		return fmt.Errorf("min_score must be >= 0")
+	}
+	if req.RandomSample < 0 {
+		return fmt.Errorf("random_sample must be >= 0")
+	}
+	if req.AfterID < 0 || req.BeforeID < 0 {
+		return fmt.Errorf("after_id and before_id must be >= 0")
+	}
+	if err := validateFields(req.Fields); err != nil {
+		return err
+	}
+	return ValidateOrderBy(req.OrderBy)
 }
 
 type SearchClient struct {
@@ -55,50 +380,668 @@ type SearchClient struct {
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+
+	httpClient    *http.Client
+	external      bool
+	timeout       time.Duration
+	transport     *http.Transport
+	dialer        *net.Dialer
+	resolver      Resolver
+	dnsPreResolve bool
+
+	etagCache bool
+	// если задан, токен берётся отсюда перед каждым запросом вместо AccessToken
+	tokenProvider func(ctx context.Context) (string, error)
+	// см. WithTokenRefresh
+	tokenRefresh   func(ctx context.Context) (string, error)
+	refreshMu      sync.Mutex
+	refreshedToken string
+	// не запрашивать лишнюю запись для NextPage
+	noNextPageProbe bool
+	// проверять каждого пришедшего пользователя через User.Validate
+	validateUsers bool
+	// потолок для PaginateAll, 0 - defaultPaginateAllMax
+	paginateAllMax int
+	// чем разбирать выдачу поиска, nil - encoding/json, см. WithJSONDecoder
+	jsonDecoder func(data []byte, v interface{}) error
+
+	// перечитывание SRV-записей, см. NewSearchClientFromSRV
+	srvRefresh time.Duration
+	stop       chan struct{}
+	stopOnce   sync.Once
+
+	mu         sync.RWMutex
+	defaultReq SearchRequest
+	etags      map[string]etagEntry
+	// версия данных сервера из последнего ETag вида "v<N>-...", при смене весь кеш выкидывается
+	etagVersion string
+	caps        *ServerCapabilities
+	// постоянные заголовки, см. SetHTTPHeader
+	headers http.Header
+
+	lastMu sync.Mutex
+	last   *SearchResponse
+
+	// см. WithResponseCache и WithMaxConcurrency
+	cache          *responseCache
+	maxConcurrency int
+
+	// куда записывать каждый поиск, см. WithRequestRecorder
+	recorder RequestStore
+	// см. Intercept, защищены mu
+	interceptors []InterceptFunc
+}
+
+// Resolver - то, через что клиент резолвит хост сервера, *net.Resolver подходит
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type Option func(*SearchClient) error
+
+// WithResolver подменяет резолвер, по умолчанию net.DefaultResolver
+func WithResolver(r Resolver) Option {
+	return func(srv *SearchClient) error {
+		srv.resolver = r
+		return nil
+	}
+}
+
+// WithDNSPreResolve резолвит хост один раз при создании клиента и дальше ходит сразу по IP
+func WithDNSPreResolve() Option {
+	return func(srv *SearchClient) error {
+		if srv.external {
+			return errExternalHTTPClient
+		}
+		srv.dnsPreResolve = true
+		return nil
+	}
+}
+
+// WithTimeout задаёт общий таймаут на запрос целиком, по умолчанию секунда
+func WithTimeout(d time.Duration) Option {
+	return func(srv *SearchClient) error {
+		if srv.external {
+			return errExternalHTTPClient
+		}
+		srv.timeout = d
+		return nil
+	}
+}
+
+// WithDialTimeout ограничивает время на установку tcp-соединения
+func WithDialTimeout(d time.Duration) Option {
+	return func(srv *SearchClient) error {
+		if _, err := srv.ensureTransport(); err != nil {
+			return err
+		}
+		srv.dialer.Timeout = d
+		return nil
+	}
+}
+
+// WithTLSHandshakeTimeout ограничивает время на TLS-рукопожатие
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(srv *SearchClient) error {
+		tr, err := srv.ensureTransport()
+		if err != nil {
+			return err
+		}
+		tr.TLSHandshakeTimeout = d
+		return nil
+	}
+}
+
+// WithResponseHeaderTimeout ограничивает время ожидания заголовков ответа после отправки запроса,
+// т.е. соединение уже есть, но сервер долго думает
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(srv *SearchClient) error {
+		tr, err := srv.ensureTransport()
+		if err != nil {
+			return err
+		}
+		tr.ResponseHeaderTimeout = d
+		return nil
+	}
+}
+
+// WithETagCache включает условные запросы: клиент запоминает ETag ответа и при повторе
+// того же запроса шлёт If-None-Match, на 304 отдаёт сохранённый ответ
+func WithETagCache() Option {
+	return func(srv *SearchClient) error {
+		srv.etagCache = true
+		return nil
+	}
+}
+
+// WithDisableNextPageProbe отключает запрос лишней записи для определения NextPage:
+// сервер отдаёт ровно limit записей, а NextPage всегда false, понять, есть ли ещё, можно по TotalCount
+func WithDisableNextPageProbe() Option {
+	return func(srv *SearchClient) error {
+		srv.noNextPageProbe = true
+		return nil
+	}
+}
+
+// WithValidateUsers включает проверку User.Validate для всех пользователей в ответе,
+// если хоть один невалиден, запрос возвращает ошибку с *UserValidationError внутри
+func WithValidateUsers() Option {
+	return func(srv *SearchClient) error {
+		srv.validateUsers = true
+		return nil
+	}
+}
+
+// WithPaginateAllMax задаёт, сколько пользователей PaginateAll готов собрать, по умолчанию defaultPaginateAllMax
+func WithPaginateAllMax(n int) Option {
+	return func(srv *SearchClient) error {
+		if n <= 0 {
+			return fmt.Errorf("paginate all max must be > 0")
+		}
+		srv.paginateAllMax = n
+		return nil
+	}
+}
+
+// WithJSONDecoder разбирает выдачу поиска через dec вместо encoding/json, например jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal.
+// Ответы с ошибками и заголовок отладки по-прежнему разбирает encoding/json
+func WithJSONDecoder(dec func(data []byte, v interface{}) error) Option {
+	return func(srv *SearchClient) error {
+		if dec == nil {
+			return fmt.Errorf("json decoder is nil")
+		}
+		srv.jsonDecoder = dec
+		return nil
+	}
+}
+
+func (srv *SearchClient) decodeJSON(data []byte, v interface{}) error {
+	if srv.jsonDecoder != nil {
+		return srv.jsonDecoder(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WithTokenProvider берёт свежий токен у fn перед каждым запросом, для короткоживущих OAuth2/OIDC токенов.
+// Токен уходит в Authorization: Bearer и в AccessToken
+func WithTokenProvider(fn func(ctx context.Context) (string, error)) Option {
+	return func(srv *SearchClient) error {
+		srv.tokenProvider = fn
+		return nil
+	}
+}
+
+// CachingTokenProvider оборачивает refresh так, чтобы полученный токен переиспользовался в течение ttl
+func CachingTokenProvider(ttl time.Duration, refresh func(ctx context.Context) (string, error)) func(ctx context.Context) (string, error) {
+	var (
+		mu        sync.Mutex
+		token     string
+		expiresAt time.Time
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Now().Before(expiresAt) {
+			return token, nil
+		}
+		fresh, err := refresh(ctx)
+		if err != nil {
+			return "", err
+		}
+		token, expiresAt = fresh, time.Now().Add(ttl)
+		return token, nil
+	}
+}
+
+// authorize проставляет в запрос заголовки авторизации, а за ними постоянные заголовки из SetHTTPHeader
+func (srv *SearchClient) authorize(ctx context.Context, req *http.Request) error {
+	token := srv.token()
+	if srv.tokenProvider != nil {
+		var err error
+		token, err = srv.tokenProvider(ctx)
+		if err != nil {
+			return fmt.Errorf("cant get access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("AccessToken", token)
+
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	for k, v := range srv.headers {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	return nil
+}
+
+// заголовки авторизации, которые SetHTTPHeader не даёт подменить
+var protectedHeaders = map[string]bool{"Accesstoken": true, "Authorization": true}
+
+// SetHTTPHeader добавляет заголовок ко всем последующим запросам клиента (X-App-Version, X-Client-ID и т.п.).
+// Заголовки уходят после авторизации, но до mutate из Do, так что тот может их поправить.
+// AccessToken и Authorization так задать нельзя, вызов для них ничего не делает
+func (srv *SearchClient) SetHTTPHeader(key, value string) {
+	key = http.CanonicalHeaderKey(key)
+	if protectedHeaders[key] {
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.headers == nil {
+		srv.headers = http.Header{}
+	}
+	srv.headers.Set(key, value)
+}
+
+// DeleteHTTPHeader убирает заголовок, заданный SetHTTPHeader
+func (srv *SearchClient) DeleteHTTPHeader(key string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.headers.Del(key)
+}
+
+var errExternalHTTPClient = errors.New("transport and timeout options cant be used with NewSearchClientFromHTTPClient")
+
+func NewSearchClient(searchURL, token string, opts ...Option) (*SearchClient, error) {
+	srv := &SearchClient{AccessToken: token, URL: searchURL, dialer: &net.Dialer{}}
+	return srv.apply(opts)
+}
+
+// NewSearchClientFromHTTPClient ходит через уже настроенный base (свои TLS, прокси, таймауты) и никак его не меняет.
+// Поэтому опции, которые трогают транспорт или таймауты, тут возвращают ошибку
+func NewSearchClientFromHTTPClient(base *http.Client, searchURL, token string, opts ...Option) (*SearchClient, error) {
+	srv := &SearchClient{AccessToken: token, URL: searchURL, httpClient: base, external: true}
+	return srv.apply(opts)
+}
+
+func (srv *SearchClient) apply(opts []Option) (*SearchClient, error) {
+	for _, opt := range opts {
+		if err := opt(srv); err != nil {
+			return nil, err
+		}
+	}
+	return srv.init()
+}
+
+// init доводит клиента до рабочего состояния после того, как применены все опции
+func (srv *SearchClient) init() (*SearchClient, error) {
+	if srv.tokenProvider != nil && srv.tokenRefresh != nil {
+		return nil, fmt.Errorf("WithTokenProvider and WithTokenRefresh cant be used together")
+	}
+	// адрес из SRV со временем меняется, а DialContext остался бы привязан к IP старого
+	if srv.dnsPreResolve && srv.srvRefresh > 0 {
+		return nil, fmt.Errorf("WithDNSPreResolve and WithSRVRefresh cant be used together")
+	}
+	if srv.dnsPreResolve {
+		if err := srv.preResolve(); err != nil {
+			return nil, err
+		}
+	}
+	if srv.external {
+		return srv, nil
+	}
+	if srv.transport != nil || srv.timeout != 0 {
+		timeout := client.Timeout
+		if srv.timeout != 0 {
+			timeout = srv.timeout
+		}
+		srv.httpClient = &http.Client{Timeout: timeout}
+		if srv.transport != nil {
+			srv.httpClient.Transport = srv.transport
+		}
+	}
+	return srv, nil
+}
+
+// Close закрывает простаивающие соединения, если у клиента свой транспорт.
+// Общий http-клиент по умолчанию и переданный в NewSearchClientFromHTTPClient не трогаются
+func (srv *SearchClient) Close() error {
+	srv.stopRefresh()
+	if srv.transport != nil {
+		srv.transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (srv *SearchClient) ensureTransport() (*http.Transport, error) {
+	if srv.external {
+		return nil, errExternalHTTPClient
+	}
+	if srv.transport == nil {
+		srv.transport = http.DefaultTransport.(*http.Transport).Clone()
+		srv.transport.DialContext = srv.dialer.DialContext
+	}
+	return srv.transport, nil
+}
+
+func (srv *SearchClient) preResolve() error {
+	u, err := url.Parse(srv.baseURL())
+	if err != nil {
+		return fmt.Errorf("bad url: %s", err)
+	}
+	resolver := srv.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupHost(context.Background(), u.Hostname())
+	if err != nil {
+		return fmt.Errorf("cant resolve %s: %s", u.Hostname(), err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("cant resolve %s: no addresses", u.Hostname())
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	tr, err := srv.ensureTransport()
+	if err != nil {
+		return err
+	}
+	dialer := srv.dialer
+	tr.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+	return nil
+}
+
+// SetDefaultRequest запоминает запрос, поля которого подставляются во все последующие
+// запросы, если в них эти поля не заданы
+func (srv *SearchClient) SetDefaultRequest(req SearchRequest) {
+	srv.mu.Lock()
+	srv.defaultReq = req
+	srv.mu.Unlock()
+}
+
+func (srv *SearchClient) ClearDefaultRequest() {
+	srv.SetDefaultRequest(SearchRequest{})
+}
+
+func (srv *SearchClient) withDefaults(req SearchRequest) SearchRequest {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return req.mergeOver(srv.defaultReq)
+}
+
+func (srv *SearchClient) getClient() *http.Client {
+	if srv.httpClient != nil {
+		return srv.httpClient
+	}
+	return client
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.Do(context.Background(), req, nil)
+}
 
-	searcherParams := url.Values{}
+// Do делает то же, что и FindUsers, но позволяет передать контекст и поправить готовый http-запрос
+// перед отправкой (mutate вызывается уже после выставления AccessToken, так что может его переопределить)
+func (srv *SearchClient) Do(ctx context.Context, req SearchRequest, mutate func(*http.Request)) (*SearchResponse, error) {
+	return srv.track(ctx, req, func() (*SearchResponse, error) {
+		return srv.do(ctx, req, mutate)
+	})
+}
 
-	if req.Limit < 0 {
-		return nil, fmt.Errorf("limit must be > 0")
+// track прогоняет ответ call через перехватчики, пишет его в recorder и запоминает как последний
+func (srv *SearchClient) track(ctx context.Context, req SearchRequest, call func() (*SearchResponse, error)) (*SearchResponse, error) {
+	start := time.Now()
+	resp, err := call()
+	if err == nil {
+		resp, err = srv.intercept(ctx, req, resp)
+	}
+	if srv.recorder != nil {
+		srv.recorder.Record(req, resp, time.Since(start), err)
+	}
+	if err == nil {
+		srv.lastMu.Lock()
+		srv.last = resp.clone()
+		srv.lastMu.Unlock()
+	}
+	return resp, err
+}
+
+// GetLastResponse возвращает копию последнего успешного ответа FindUsers/Do или nil, если его ещё не было
+func (srv *SearchClient) GetLastResponse() *SearchResponse {
+	srv.lastMu.Lock()
+	defer srv.lastMu.Unlock()
+	if srv.last == nil {
+		return nil
+	}
+	return srv.last.clone()
+}
+
+// ClearLastResponse забывает последний ответ, GetLastResponse снова вернёт nil
+func (srv *SearchClient) ClearLastResponse() {
+	srv.lastMu.Lock()
+	srv.last = nil
+	srv.lastMu.Unlock()
+}
+
+func (srv *SearchClient) do(ctx context.Context, req SearchRequest, mutate func(*http.Request)) (*SearchResponse, error) {
+	return srv.search(ctx, srv.withDefaults(req), mutate)
+}
+
+// search - то же, что do, но без умолчаний из SetDefaultRequest
+func (srv *SearchClient) search(ctx context.Context, req SearchRequest, mutate func(*http.Request)) (*SearchResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := srv.checkCapabilities(ctx, req); err != nil {
+		return nil, err
 	}
 	if req.Limit > 25 {
 		req.Limit = 25
 	}
-	if req.Offset < 0 {
-		return nil, fmt.Errorf("offset must be > 0")
+
+	if srv.noNextPageProbe {
+		if req.Limit == 0 {
+			return &SearchResponse{Users: []User{}}, nil
+		}
+		return srv.fetch(ctx, req, mutate)
 	}
 
 	//нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
 	req.Limit++
 
-	searcherParams.Add("limit", strconv.Itoa(req.Limit))
-	searcherParams.Add("offset", strconv.Itoa(req.Offset))
-	searcherParams.Add("query", req.Query)
-	searcherParams.Add("order_field", req.OrderField)
-	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
+	result, err := srv.fetch(ctx, req, mutate)
+	if err != nil {
+		return nil, err
+	}
+
+	data := result.Users
+	if len(data) == req.Limit {
+		result.NextPage = true
+		result.Users = data[0 : len(data)-1]
+	} else {
+		result.Users = data[0:len(data)]
+		// сервер мог урезать limit до своего максимума, тогда лишней записи нет, но есть X-Total-Count
+		result.NextPage = result.TotalCount > req.Offset+len(result.Users)
+	}
+
+	return result, err
+}
+
+// StreamUsers вызывает fn для каждого найденного пользователя, сам проходя по страницам.
+// req.Limit тут - общее ограничение на количество пользователей, а не размер страницы.
+// Если req.Limit == 0 - забираем всё одним запросом с limit=-1, сервер должен поддерживать такой режим,
+// а если он урезал выдачу до своего максимума, остальное дочитывается страницами
+func (srv *SearchClient) StreamUsers(ctx context.Context, req SearchRequest, fn func(User) error) error {
+	return srv.stream(ctx, srv.withDefaults(req), fn)
+}
+
+// stream - то же, что StreamUsers, но без умолчаний из SetDefaultRequest
+func (srv *SearchClient) stream(ctx context.Context, req SearchRequest, fn func(User) error) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if err := srv.checkCapabilities(ctx, req); err != nil {
+		return err
+	}
+
+	if req.Limit == 0 {
+		req.Limit = -1
+		// сколько отдал сам сервер, перехватчики могли выдачу проредить
+		var served, total int
+		result, err := srv.track(ctx, req, func() (*SearchResponse, error) {
+			res, err := srv.fetch(ctx, req, nil)
+			if err == nil {
+				served, total = len(res.Users), res.TotalCount
+			}
+			return res, err
+		})
+		if err != nil {
+			return err
+		}
+		for _, u := range result.Users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		// сервер мог урезать выдачу до своего максимума, остальное дочитываем страницами
+		if served == 0 || total <= served {
+			return nil
+		}
+		req.Limit = total - served
+		req.Offset += served
+	}
+
+	left := req.Limit
+	for left > 0 {
+		page := req
+		page.Limit = left
+		resp, err := srv.track(ctx, page, func() (*SearchResponse, error) {
+			return srv.search(ctx, page, nil)
+		})
+		if err != nil {
+			return err
+		}
+		for _, u := range resp.Users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		left -= len(resp.Users)
+		req.Offset += len(resp.Users)
+		if !resp.NextPage || len(resp.Users) == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+const defaultPaginateAllMax = 10000
+
+// ErrTooManyResults - под запрос PaginateAll подходит больше пользователей, чем разрешено WithPaginateAllMax
+var ErrTooManyResults = errors.New("too many results")
 
-	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
+// PaginateAll собирает в один слайс всех пользователей, которых отдал бы StreamUsers.
+// req.Limit - общее ограничение, 0 - все. Если подходящих больше, чем paginateAllMax, и req.Limit
+// их не отсекает, возвращается ErrTooManyResults, а не обрезанный список
+func (srv *SearchClient) PaginateAll(ctx context.Context, req SearchRequest) ([]User, error) {
+	max := srv.paginateAllMax
+	if max == 0 {
+		max = defaultPaginateAllMax
+	}
+	// просим на одного больше максимума, чтобы отличить "ровно max" от "больше max"
+	if req.Limit == 0 || req.Limit > max {
+		req.Limit = max + 1
+	}
 
-	resp, err := client.Do(searcherReq)
+	users := []User{}
+	err := srv.StreamUsers(ctx, req, func(u User) error {
+		users = append(users, u)
+		return nil
+	})
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
+		return nil, err
+	}
+	if len(users) > max {
+		return nil, fmt.Errorf("%w: more than %d users match", ErrTooManyResults, max)
+	}
+	return users, nil
+}
+
+// fetch отправляет req как есть (без правок limit) и разбирает ответ сервера
+// в ответе Users - всё, что прислал сервер, NextPage не выставляется
+func (srv *SearchClient) fetch(ctx context.Context, req SearchRequest, mutate func(*http.Request)) (*SearchResponse, error) {
+	searcherParams := req.values()
+	// кеш хранит полных пользователей, поэтому fields в ключ не входят
+	keyParams := req.values()
+	keyParams.Del("fields")
+	key := keyParams.Encode()
+	// выдача зависит от арендатора, а он едет в заголовке, так что кеш ETag должен их различать
+	if tenant, ok := tenantFromContext(ctx); ok {
+		key = "tenant:" + tenant + "?" + key
+	}
+
+	useCache := srv.cache != nil && mutate == nil
+	if useCache {
+		if res, ok := srv.cache.get(key); ok {
+			res.Users = projectUsers(res.Users, req.Fields)
+			return res, nil
+		}
+	}
+
+	cached, hasCached := srv.cachedETag(key)
+	etag := ""
+	if hasCached {
+		etag = cached.etag
+	}
+	u := srv.baseURL() + "?" + searcherParams.Encode()
+	prepare := func(etag string) func(*http.Request) {
+		return func(r *http.Request) {
+			if etag != "" {
+				r.Header.Set("If-None-Match", etag)
+			}
+			if mutate != nil {
+				mutate(r)
+			}
+		}
+	}
+	resp, body, err := srv.send(ctx, http.MethodGet, u, nil, prepare(etag))
+	if err != nil {
+		return nil, err
+	}
+	// 412 на If-None-Match значит, что закешированный ETag протух (например, сервер перечитал датасет) -
+	// выкидываем его и один раз перезапрашиваем без условия
+	if resp.StatusCode == http.StatusPreconditionFailed && etag != "" {
+		srv.dropETag(key)
+		hasCached = false
+		resp, body, err = srv.send(ctx, http.MethodGet, u, nil, prepare(""))
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("unknown error %s", err)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
 
 	switch resp.StatusCode {
 	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
+		return nil, &AuthError{URL: u}
 	case http.StatusInternalServerError:
 		return nil, fmt.Errorf("SearchServer fatal error")
+	case http.StatusPreconditionFailed:
+		return nil, fmt.Errorf("precondition failed for %s", key)
+	case http.StatusNotModified:
+		if hasCached {
+			res := cached.resp
+			res.Users = projectUsers(append([]User(nil), cached.resp.Users...), req.Fields)
+			res.RequestID = resp.Header.Get("X-Request-ID")
+			return &res, nil
+		}
+		return nil, fmt.Errorf("not modified, but nothing cached for %s", key)
 	case http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
@@ -112,18 +1055,182 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	}
 
 	data := []User{}
-	err = json.Unmarshal(body, &data)
+	err = srv.decodeJSON(body, &data)
 	if err != nil {
 		return nil, fmt.Errorf("cant unpack result json: %s", err)
 	}
+	if srv.validateUsers {
+		for _, u := range data {
+			if err := u.Validate(); err != nil {
+				return nil, fmt.Errorf("bad user in response: %w", err)
+			}
+		}
+	}
 
-	result := SearchResponse{}
-	if len(data) == req.Limit {
-		result.NextPage = true
-		result.Users = data[0 : len(data)-1]
-	} else {
-		result.Users = data[0:len(data)]
+	result := &SearchResponse{Users: data, RequestID: resp.Header.Get("X-Request-ID")}
+	if total := resp.Header.Get("X-Total-Count"); total != "" {
+		result.TotalCount, err = strconv.Atoi(total)
+		if err != nil {
+			return nil, fmt.Errorf("bad X-Total-Count: %s", err)
+		}
 	}
+	if debug := resp.Header.Get("X-Search-Debug"); debug != "" {
+		if err := json.Unmarshal([]byte(debug), &result.Debug); err != nil {
+			return nil, fmt.Errorf("cant unpack debug json: %s", err)
+		}
+	}
+	if newETag := resp.Header.Get("ETag"); newETag != "" {
+		srv.storeETag(key, newETag, *result)
+	}
+	if useCache {
+		srv.cache.put(key, result)
+	}
+	// кеш хранит полных пользователей, fields в ключ не входят
+	result.Users = projectUsers(result.Users, req.Fields)
+	return result, nil
+}
 
-	return &result, err
+// send делает запрос к серверу со всем, что клиент добавляет к любому запросу: авторизацией, заголовками
+// из SetHTTPHeader, арендатором и traceparent из ctx. prepare, если не nil, правит готовый запрос последним.
+// С WithTokenRefresh на 401 токен обновляется и запрос повторяется ровно один раз.
+// Не дошедший до сервера запрос возвращает ошибку с *NetworkError внутри, тело ответа уже вычитано
+func (srv *SearchClient) send(ctx context.Context, method, u string, body []byte, prepare func(*http.Request)) (*http.Response, []byte, error) {
+	used := srv.token()
+	resp, respBody, err := srv.sendOnce(ctx, method, u, body, prepare)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || srv.tokenRefresh == nil {
+		return resp, respBody, err
+	}
+	// токен протух - берём новый и повторяем ровно один раз
+	if err := srv.refreshToken(ctx, used); err != nil {
+		return nil, nil, err
+	}
+	return srv.sendOnce(ctx, method, u, body, prepare)
+}
+
+func (srv *SearchClient) sendOnce(ctx context.Context, method, u string, body []byte, prepare func(*http.Request)) (*http.Response, []byte, error) {
+	var payload io.Reader
+	if body != nil {
+		payload = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cant build request: %s", err)
+	}
+	if err := srv.authorize(ctx, req); err != nil {
+		return nil, nil, err
+	}
+	if tenant, ok := tenantFromContext(ctx); ok {
+		req.Header.Set("X-Tenant-ID", tenant)
+	}
+	// traceparent из ctx, если он есть, чтобы вызовы из обработчиков сервера оставались в той же трассе
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := srv.getClient().Do(req)
+	if err != nil {
+		netErr := &NetworkError{URL: srv.baseURL(), Err: err}
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			return nil, nil, fmt.Errorf("timeout for %s: %w", u, netErr)
+		}
+		return nil, nil, fmt.Errorf("unknown error %w", netErr)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cant read response: %s", err)
+	}
+	return resp, respBody, nil
+}
+
+type etagEntry struct {
+	etag string
+	resp SearchResponse
+}
+
+func (srv *SearchClient) cachedETag(key string) (etagEntry, bool) {
+	if !srv.etagCache {
+		return etagEntry{}, false
+	}
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	e, ok := srv.etags[key]
+	return e, ok
+}
+
+func (srv *SearchClient) storeETag(key, etag string, resp SearchResponse) {
+	if !srv.etagCache {
+		return
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if version := etagDataVersion(etag); version != "" {
+		if srv.etagVersion != "" && version != srv.etagVersion {
+			srv.etags = nil
+		}
+		srv.etagVersion = version
+	}
+	if srv.etags == nil {
+		srv.etags = map[string]etagEntry{}
+	}
+	srv.etags[key] = etagEntry{etag: etag, resp: resp}
+}
+
+var etagVersionRe = regexp.MustCompile(`^(?:W/)?"(v\d+)-`)
+
+// etagDataVersion достаёт версию данных из ETag сервера, для чужих ETag - пустая строка
+func etagDataVersion(etag string) string {
+	m := etagVersionRe.FindStringSubmatch(etag)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// InvalidateCache выкидывает все закешированные ответы (по ETag и WithResponseCache),
+// например если известно, что данные на сервере поменялись
+func (srv *SearchClient) InvalidateCache() {
+	if srv.cache != nil {
+		srv.cache.clear()
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.etags = nil
+	srv.etagVersion = ""
+}
+
+func (srv *SearchClient) dropETag(key string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.etags, key)
+}
+
+// NetworkError - до сервера не достучались, ответа нет вообще
+type NetworkError struct {
+	URL string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("cant reach %s: %s", e.URL, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// TestConnectivity шлёт HEAD на поиск с limit=1 и возвращает время ответа вместе с установкой соединения
+func (srv *SearchClient) TestConnectivity(ctx context.Context) (time.Duration, error) {
+	params := url.Values{"limit": {"1"}, "offset": {"0"}}
+	start := time.Now()
+	resp, _, err := srv.send(ctx, http.MethodHead, srv.baseURL()+"?"+params.Encode(), nil, nil)
+	latency := time.Since(start)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return latency, fmt.Errorf("server unhealthy: %s", resp.Status)
+	}
+	return latency, nil
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+type countingResolver struct {
+	mu    sync.Mutex
+	calls int
+	addrs []string
+	err   error
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	return r.addrs, r.err
+}
+
+func TestWithDNSPreResolve(t *testing.T) {
+	ts := NewTestServer(t)
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	res := &countingResolver{addrs: []string{"127.0.0.1"}}
+	sc, err := NewSearchClient("http://search.invalid:"+u.Port(), "test_token",
+		WithResolver(res), WithDNSPreResolve())
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.calls)
+
+	for i := 0; i < 10; i++ {
+		resp, err := sc.FindUsers(SearchRequest{Limit: 1})
+		require.NoError(t, err)
+		assert.Len(t, resp.Users, 1)
+	}
+	assert.Equal(t, 1, res.calls)
+}
+
+func TestWithDNSPreResolve_Errors(t *testing.T) {
+	_, err := NewSearchClient("http://search.invalid", "test_token",
+		WithResolver(&countingResolver{err: errors.New("no such host")}), WithDNSPreResolve())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such host")
+
+	_, err = NewSearchClient("http://search.invalid", "test_token",
+		WithResolver(&countingResolver{}), WithDNSPreResolve())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no addresses")
+
+	_, err = NewSearchClient("://bad", "test_token", WithDNSPreResolve())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad url")
+}
+
+func TestNewSearchClient_NoOptions(t *testing.T) {
+	ts := NewTestServer(t)
+	sc, err := NewSearchClient(ts.URL, "test_token")
+	require.NoError(t, err)
+	resp, err := sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, resp.Users, 1)
+}
+
+func TestTransportTimeoutOptions(t *testing.T) {
+	sc, err := NewSearchClient("http://localhost", "test_token",
+		WithDialTimeout(100*time.Millisecond),
+		WithTLSHandshakeTimeout(200*time.Millisecond),
+		WithResponseHeaderTimeout(300*time.Millisecond))
+	require.NoError(t, err)
+	require.NotNil(t, sc.transport)
+	assert.Equal(t, 100*time.Millisecond, sc.dialer.Timeout)
+	assert.Equal(t, 200*time.Millisecond, sc.transport.TLSHandshakeTimeout)
+	assert.Equal(t, 300*time.Millisecond, sc.transport.ResponseHeaderTimeout)
+	assert.Same(t, sc.transport, sc.getClient().Transport)
+
+	plain, err := NewSearchClient("http://localhost", "test_token")
+	require.NoError(t, err)
+	assert.Same(t, client, plain.getClient())
+}
+
+func TestWithResponseHeaderTimeout_Fires(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		ServerSearch(w, r)
+	}))
+	defer ts.Close()
+
+	sc, err := NewSearchClient(ts.URL, "test_token", WithResponseHeaderTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout for")
+	assert.Contains(t, err.Error(), "awaiting response headers")
+	assert.Less(t, time.Since(start), client.Timeout)
+
+	sc, err = NewSearchClient(ts.URL, "test_token", WithResponseHeaderTimeout(time.Second))
+	require.NoError(t, err)
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+}
+
+type countingTransport struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestNewSearchClientFromHTTPClient(t *testing.T) {
+	ts := NewTestServer(t)
+	tr := &countingTransport{}
+	base := &http.Client{Transport: tr, Timeout: 3 * time.Second}
+
+	sc, err := NewSearchClientFromHTTPClient(base, ts.URL, "test_token", WithETagCache())
+	require.NoError(t, err)
+	assert.Same(t, base, sc.getClient())
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, tr.calls)
+	assert.Same(t, tr, base.Transport)
+	assert.Equal(t, 3*time.Second, base.Timeout)
+
+	for name, opt := range map[string]Option{
+		"Timeout":               WithTimeout(time.Second),
+		"DialTimeout":           WithDialTimeout(time.Second),
+		"TLSHandshakeTimeout":   WithTLSHandshakeTimeout(time.Second),
+		"ResponseHeaderTimeout": WithResponseHeaderTimeout(time.Second),
+		"DNSPreResolve":         WithDNSPreResolve(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewSearchClientFromHTTPClient(base, ts.URL, "test_token", opt)
+			assert.ErrorIs(t, err, errExternalHTTPClient)
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	sc, err := NewSearchClient("http://localhost", "test_token", WithTimeout(5*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, sc.getClient().Timeout)
+	assert.Nil(t, sc.getClient().Transport)
+
+	sc, err = NewSearchClient("http://localhost", "test_token", WithResponseHeaderTimeout(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, client.Timeout, sc.getClient().Timeout)
+}
+
+func TestWithDisableNextPageProbe(t *testing.T) {
+	ts := NewTestServer(t)
+	sc, err := NewSearchClient(ts.URL, "test_token", WithDisableNextPageProbe())
+	require.NoError(t, err)
+
+	for _, limit := range []int{1, 10, 25} {
+		resp, err := sc.FindUsers(SearchRequest{Limit: limit, OrderField: "Id", OrderBy: OrderByAsc})
+		require.NoError(t, err)
+		assert.Len(t, resp.Users, limit)
+		assert.False(t, resp.NextPage)
+		assert.Equal(t, len(dataset.Rows), resp.TotalCount)
+		ts.AssertNextRequest(t, SearchRequest{Limit: limit, OrderField: "Id", OrderBy: OrderByAsc})
+	}
+
+	resp, err := sc.FindUsers(SearchRequest{Limit: 0})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Users)
+	assert.Empty(t, ts.received)
+}
+
+func TestTestConnectivity(t *testing.T) {
+	ts := NewTestServer(t)
+	sc, err := NewSearchClient(ts.URL, "test_token")
+	require.NoError(t, err)
+	defer sc.Close()
+
+	latency, err := sc.TestConnectivity(context.Background())
+	require.NoError(t, err)
+	assert.Greater(t, latency, time.Duration(0))
+	assert.Less(t, latency, 100*time.Millisecond)
+
+	ts.Close()
+	_, err = sc.TestConnectivity(context.Background())
+	var netErr *NetworkError
+	require.ErrorAs(t, err, &netErr)
+	assert.Equal(t, ts.URL, netErr.URL)
+}
+
+// все ручки клиента ходят через send: одинаково обновляют токен, передают арендатора и трассу
+// и одинаково сообщают о недоступном сервере
+func TestSend_SameForEveryEndpoint(t *testing.T) {
+	type seen struct{ token, tenant, traceparent string }
+	var mu sync.Mutex
+	got := map[string][]seen{}
+	s := NewSearchServer()
+	ts := httptest.NewServer(TenantScopeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got[r.URL.Path] = append(got[r.URL.Path], seen{r.Header.Get("AccessToken"), r.Header.Get("X-Tenant-ID"), r.Header.Get("traceparent")})
+		mu.Unlock()
+		if r.Header.Get("AccessToken") != "fresh" {
+			writeError(w, http.StatusUnauthorized, "expired")
+			return
+		}
+		s.ServeHTTP(w, r)
+	})))
+	defer ts.Close()
+
+	calls := map[string]func(ctx context.Context, sc *SearchClient) error{
+		"/": func(ctx context.Context, sc *SearchClient) error {
+			_, err := sc.TestConnectivity(ctx)
+			return err
+		},
+		"/search/count": func(ctx context.Context, sc *SearchClient) error {
+			_, err := sc.CountUsers(ctx, SearchRequest{})
+			return err
+		},
+		"/search/explain": func(ctx context.Context, sc *SearchClient) error {
+			_, err := sc.Explain(ctx, SearchRequest{Limit: 1})
+			return err
+		},
+		"/users/0": func(ctx context.Context, sc *SearchClient) error {
+			_, err := sc.FindUserByID(ctx, 0, true)
+			if errors.Is(err, ErrUserNotFound) {
+				return nil
+			}
+			return err
+		},
+		"/users/bulk": func(ctx context.Context, sc *SearchClient) error {
+			_, err := sc.BulkFindUsersByIDs(ctx, []int{0})
+			return err
+		},
+		"/capabilities": func(ctx context.Context, sc *SearchClient) error {
+			_, err := sc.GetCapabilities(ctx)
+			return err
+		},
+		"/healthz": func(ctx context.Context, sc *SearchClient) error {
+			_, err := sc.Healthcheck(ctx)
+			return err
+		},
+	}
+	ctx := propagation.TraceContext{}.Extract(WithTenantScope(context.Background(), "acme"),
+		propagation.HeaderCarrier{"Traceparent": {testTraceparent}})
+	for path, call := range calls {
+		sc, err := NewSearchClient(ts.URL, "expired", WithTokenRefresh(func(context.Context) (string, error) {
+			return "fresh", nil
+		}))
+		require.NoError(t, err)
+		require.NoError(t, call(ctx, sc), path)
+		assert.Equal(t, []seen{{"expired", "acme", testTraceparent}, {"fresh", "acme", testTraceparent}}, got[path], path)
+	}
+
+	ts.Close()
+	for path, call := range calls {
+		sc := &SearchClient{AccessToken: "fresh", URL: ts.URL}
+		var netErr *NetworkError
+		assert.ErrorAs(t, call(ctx, sc), &netErr, path)
+	}
+}
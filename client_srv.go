@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SRVResolver - резолвер, который умеет SRV-записи, *net.Resolver подходит.
+// Если переданный в WithResolver резолвер его не реализует, SRV ищется через net.DefaultResolver
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// WithSRVRefresh задаёт, как часто NewSearchClientFromSRV перечитывает SRV-записи, 0 - один раз при создании
+func WithSRVRefresh(d time.Duration) Option {
+	return func(srv *SearchClient) error {
+		if d < 0 {
+			return fmt.Errorf("bad srv refresh interval: %s", d)
+		}
+		srv.srvRefresh = d
+		return nil
+	}
+}
+
+// NewSearchClientFromSRV берёт адрес сервера из первой SRV-записи _service._proto.domain.
+// Токен задаётся через AccessToken или WithTokenProvider, перечитывание останавливается в Close
+func NewSearchClientFromSRV(service, proto, domain string, opts ...Option) (*SearchClient, error) {
+	srv := &SearchClient{dialer: &net.Dialer{}}
+	for _, opt := range opts {
+		if err := opt(srv); err != nil {
+			return nil, err
+		}
+	}
+	lookup := func() (string, error) {
+		return srv.lookupSRV(service, proto, domain)
+	}
+	u, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+	srv.URL = u
+	if _, err := srv.init(); err != nil {
+		return nil, err
+	}
+	if srv.srvRefresh > 0 {
+		srv.stop = make(chan struct{})
+		go srv.refreshURL(lookup)
+	}
+	return srv, nil
+}
+
+func (srv *SearchClient) lookupSRV(service, proto, domain string) (string, error) {
+	resolver, ok := srv.resolver.(SRVResolver)
+	if !ok {
+		resolver = net.DefaultResolver
+	}
+	_, addrs, err := resolver.LookupSRV(context.Background(), service, proto, domain)
+	if err != nil {
+		return "", fmt.Errorf("cant lookup srv for %s: %s", domain, err)
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("cant lookup srv for %s: no records", domain)
+	}
+	host := strings.TrimSuffix(addrs[0].Target, ".")
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(int(addrs[0].Port))), nil
+}
+
+// refreshURL раз в srvRefresh подменяет URL, ошибки поиска оставляют старый адрес.
+// Закэшированные ответы и ETag получены от прежнего сервера, при смене адреса они сбрасываются
+func (srv *SearchClient) refreshURL(lookup func() (string, error)) {
+	ticker := time.NewTicker(srv.srvRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-srv.stop:
+			return
+		case <-ticker.C:
+			u, err := lookup()
+			if err != nil {
+				continue
+			}
+			srv.mu.Lock()
+			changed := srv.URL != u
+			srv.URL = u
+			srv.mu.Unlock()
+			if changed {
+				srv.InvalidateCache()
+			}
+		}
+	}
+}
+
+func (srv *SearchClient) stopRefresh() {
+	if srv.stop == nil {
+		return
+	}
+	srv.stopOnce.Do(func() {
+		close(srv.stop)
+	})
+}
+
+func (srv *SearchClient) baseURL() string {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return srv.URL
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type srvResolver struct {
+	countingResolver
+	mu      sync.Mutex
+	records []*net.SRV
+	err     error
+}
+
+func (r *srvResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return "_" + service + "._" + proto + "." + name, r.records, r.err
+}
+
+func (r *srvResolver) set(records ...*net.SRV) {
+	r.mu.Lock()
+	r.records = records
+	r.mu.Unlock()
+}
+
+func srvRecord(t *testing.T, rawURL string) *net.SRV {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	return &net.SRV{Target: u.Hostname() + ".", Port: uint16(port)}
+}
+
+func TestNewSearchClientFromSRV(t *testing.T) {
+	first, second := NewTestServer(t), NewTestServer(t)
+	res := &srvResolver{}
+	res.set(srvRecord(t, first.URL), srvRecord(t, second.URL))
+
+	sc, err := NewSearchClientFromSRV("search", "tcp", "example.test", WithResolver(res), WithSRVRefresh(10*time.Millisecond))
+	require.NoError(t, err)
+	defer sc.Close()
+	assert.Equal(t, first.URL, sc.baseURL())
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, Query: "first"})
+	require.NoError(t, err)
+	first.AssertNextRequest(t, SearchRequest{Limit: 2, Query: "first"})
+
+	res.set(srvRecord(t, second.URL))
+	require.Eventually(t, func() bool {
+		return sc.baseURL() == second.URL
+	}, time.Second, 5*time.Millisecond)
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, Query: "second"})
+	require.NoError(t, err)
+	second.AssertNextRequest(t, SearchRequest{Limit: 2, Query: "second"})
+
+	sc.Close()
+	sc.Close()
+}
+
+func TestNewSearchClientFromSRV_Errors(t *testing.T) {
+	_, err := NewSearchClientFromSRV("search", "tcp", "example.test", WithResolver(&srvResolver{err: errors.New("no such host")}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such host")
+
+	_, err = NewSearchClientFromSRV("search", "tcp", "example.test", WithResolver(&srvResolver{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no records")
+
+	_, err = NewSearchClientFromSRV("search", "tcp", "example.test", WithSRVRefresh(-time.Second))
+	require.Error(t, err)
+
+	res := &srvResolver{}
+	res.set(&net.SRV{Target: "127.0.0.1.", Port: 80})
+	_, err = NewSearchClientFromSRV("search", "tcp", "example.test", WithResolver(res), WithDNSPreResolve(), WithSRVRefresh(time.Second))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cant be used together")
+}
+
+func TestNewSearchClientFromSRV_DropsCacheOnSwitch(t *testing.T) {
+	first, second := NewTestServer(t), NewTestServer(t)
+	res := &srvResolver{}
+	res.set(srvRecord(t, first.URL))
+
+	sc, err := NewSearchClientFromSRV("search", "tcp", "example.test", WithResolver(res),
+		WithSRVRefresh(10*time.Millisecond), WithResponseCache(10, time.Hour))
+	require.NoError(t, err)
+	defer sc.Close()
+	req := SearchRequest{Limit: 1, Query: "cached"}
+	_, err = sc.FindUsers(req)
+	require.NoError(t, err)
+	first.AssertNextRequest(t, SearchRequest{Limit: 2, Query: "cached"})
+
+	res.set(srvRecord(t, second.URL))
+	require.Eventually(t, func() bool {
+		return sc.baseURL() == second.URL
+	}, time.Second, 5*time.Millisecond)
+	_, err = sc.FindUsers(req)
+	require.NoError(t, err)
+	second.AssertNextRequest(t, SearchRequest{Limit: 2, Query: "cached"})
+}
@@ -1,20 +1,34 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"math/rand"
+	"mime"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// теги без пространства имён encoding/xml сопоставляет только по локальному имени,
+// поэтому выгрузки вида <ns:DataSet xmlns:ns="..."><ns:row>... читаются так же, как обычные
 type Row struct {
 	ID        int    `xml:"id"`
 	IsActive  bool   `xml:"isActive"`
@@ -23,126 +37,968 @@ type Row struct {
 	About     string `xml:"about"`
 	Age       int    `xml:"age"`
 	Gender    string `xml:"gender"`
+	// ненулевое значение - пользователь удалён, но строка осталась
+	DeletedAt time.Time `xml:"deleted_at,omitempty"`
+	// арендатор, которому принадлежит пользователь, см. TenantScopeMiddleware
+	TenantID string `xml:"tenant_id,omitempty"`
 }
 
 type DataSet struct {
 	Rows []Row `xml:"row"`
+
+	Stats map[string]FieldStats `xml:"-"`
 }
 
 var dataset DataSet
 
 func init() {
-	data, err := os.ReadFile("dataset.xml")
+	var err error
+	dataset, err = LoadDataSet("dataset.xml")
 	if err != nil {
 		panic(err)
 	}
-	err = xml.Unmarshal(data, &dataset)
+}
+
+var ErrDatasetTooSmall = errors.New("dataset too small")
+
+type DataSetLoader struct {
+	Path string
+	// если строк меньше - пишем предупреждение в Logger, а с FailOnSmallDataset ещё и возвращаем ошибку
+	MinDatasetRows     int
+	FailOnSmallDataset bool
+	Logger             *slog.Logger
+	// без этого датасет с повторяющимися id не загрузится
+	AllowDuplicateIDs bool
+}
+
+// DuplicateIDError - в датасете несколько строк с одинаковым id, IDs - все такие id по возрастанию
+type DuplicateIDError struct {
+	IDs []int
+}
+
+func (e *DuplicateIDError) Error() string {
+	ids := make([]string, len(e.IDs))
+	for i, id := range e.IDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return "duplicate ids in dataset: " + strings.Join(ids, ", ")
+}
+
+func duplicateIDs(rows []Row) []int {
+	seen := make(map[int]bool, len(rows))
+	reported := map[int]bool{}
+	var dups []int
+	for _, row := range rows {
+		if seen[row.ID] && !reported[row.ID] {
+			reported[row.ID] = true
+			dups = append(dups, row.ID)
+		}
+		seen[row.ID] = true
+	}
+	sort.Ints(dups)
+	return dups
+}
+
+// Merge дописывает строки other в конец, если id повторяются - DuplicateIDError и исходный датасет
+func (ds DataSet) Merge(other DataSet) (DataSet, error) {
+	rows := append(append([]Row(nil), ds.Rows...), other.Rows...)
+	if dups := duplicateIDs(rows); len(dups) > 0 {
+		return ds, &DuplicateIDError{IDs: dups}
+	}
+	return DataSet{Rows: rows, Stats: computeFieldStats(rows)}, nil
+}
+
+// MergeLoose дописывает строки other, при повторе id остаётся последняя из строк на месте первой
+func (ds DataSet) MergeLoose(other DataSet) DataSet {
+	pos := map[int]int{}
+	var rows []Row
+	for _, row := range append(append([]Row(nil), ds.Rows...), other.Rows...) {
+		if i, ok := pos[row.ID]; ok {
+			rows[i] = row
+			continue
+		}
+		pos[row.ID] = len(rows)
+		rows = append(rows, row)
+	}
+	return DataSet{Rows: rows, Stats: computeFieldStats(rows)}
+}
+
+func NewDataSetLoader(path string) *DataSetLoader {
+	return &DataSetLoader{Path: path, MinDatasetRows: 1, Logger: slog.Default()}
+}
+
+func LoadDataSet(path string) (DataSet, error) {
+	return NewDataSetLoader(path).Load()
+}
+
+func (l *DataSetLoader) Load() (DataSet, error) {
+	var ds DataSet
+	data, err := os.ReadFile(l.Path)
 	if err != nil {
-		panic(err)
+		return ds, err
+	}
+	err = xml.Unmarshal(data, &ds)
+	if err != nil {
+		return ds, err
+	}
+	if len(ds.Rows) < l.MinDatasetRows {
+		l.Logger.Warn("dataset is suspiciously small",
+			"path", l.Path, "rows", len(ds.Rows), "min_rows", l.MinDatasetRows)
+		if l.FailOnSmallDataset {
+			return ds, fmt.Errorf("%w: %s has %d rows, want at least %d",
+				ErrDatasetTooSmall, l.Path, len(ds.Rows), l.MinDatasetRows)
+		}
 	}
+	if !l.AllowDuplicateIDs {
+		if dups := duplicateIDs(ds.Rows); len(dups) > 0 {
+			return ds, &DuplicateIDError{IDs: dups}
+		}
+	}
+	ds.Stats = computeFieldStats(ds.Rows)
+	return ds, nil
 }
 
-func ServerSearch(w http.ResponseWriter, r *http.Request) {
-	query := r.FormValue("query")
-	orderField := r.FormValue("order_field")
-	if orderField == "" {
-		orderField = "Name"
+type SearchServer struct {
+	NoLimitAllowed bool
+	// запросы длиннее отклоняются, чтобы не гонять strings.Contains по огромным строкам.
+	// Меняется на лету через PATCH /admin/config, поэтому после старта читается только через settings()
+	MaxQueryLength int
+	// больший limit молча урезается до maxLimit, 0 - без ограничения
+	maxLimit int
+	cfgMu    sync.RWMutex
+	// не схлопывать пробелы в запросах, см. NormalizeQuery
+	DisableQueryNormalization bool
+	// внешние имена полей сортировки -> внутренние, например "full_name" -> "Name"
+	FieldAliases map[string]string
+
+	mux *http.ServeMux
+	// mux со всеми обёртками, собирается один раз в NewSearchServer
+	handler http.Handler
+	// описания ручек для /openapi.json, см. handle
+	routes []routeDoc
+
+	// мутации не меняют Rows на месте, а подменяют слайс целиком, так что снимок из data() можно читать без блокировки
+	mu       sync.RWMutex
+	ds       DataSet
+	loadedAt time.Time
+
+	startedAt time.Time
+	active    atomic.Int64
+	// отдавать документацию на GET / без параметров
+	docs bool
+	// пустой - профилирование выключено
+	profilingSecret string
+	// пустой - ручек /admin/ нет
+	managementToken string
+	http2Push       bool
+	envelope        bool
+	// отдавать выдачу поиска по одному пользователю, см. WithStreaming
+	streaming bool
+	// локаль для сортировки по Name, пустая - побайтово
+	collation string
+	// отдавать ETag с версией данных и 304 на If-None-Match
+	searchETags bool
+	// SEARCH_TRACE=1 - складывать трассировку каждого поиска в traces
+	tracing bool
+	traces  traceRing
+	// растёт при каждом изменении данных
+	version atomic.Uint64
+
+	// индекс подменяется целиком, читатели работают со старым, пока строится новый
+	indexed bool
+	index   atomic.Pointer[searchIndex]
+
+	changelog changeLog
+
+	// nil - в /admin/ пускают с любого адреса, см. WithAdminAllowlist
+	adminAllowlist Middleware
+	// nil - вебхуки выключены, см. WithWebhookNotifier
+	webhook *webhookNotifier
+	// nil - About хранится открытым, см. WithAboutEncryption
+	aboutCipher *aboutCipher
+}
+
+type ServerOption func(*SearchServer)
+
+func WithNoLimitAllowed(allowed bool) ServerOption {
+	return func(s *SearchServer) {
+		s.NoLimitAllowed = allowed
+	}
+}
+
+// WithDataSet подменяет данные сервера, по умолчанию - загруженный из dataset.xml
+func WithDataSet(ds DataSet) ServerOption {
+	return func(s *SearchServer) {
+		s.ds = ds
+	}
+}
+
+func WithMaxQueryLength(n int) ServerOption {
+	return func(s *SearchServer) {
+		s.MaxQueryLength = n
+	}
+}
+
+// WithFieldAliases задаёт FieldAliases, алиасы разрешаются до проверки order_field и полей order_criteria
+func WithFieldAliases(aliases map[string]string) ServerOption {
+	return func(s *SearchServer) {
+		s.FieldAliases = aliases
+	}
+}
+
+func WithDisableQueryNormalization(disable bool) ServerOption {
+	return func(s *SearchServer) {
+		s.DisableQueryNormalization = disable
+	}
+}
+
+const defaultMaxQueryLength = 256
+
+func NewSearchServer(opts ...ServerOption) *SearchServer {
+	now := time.Now()
+	s := &SearchServer{
+		mux: http.NewServeMux(), ds: dataset, MaxQueryLength: defaultMaxQueryLength,
+		startedAt: now, loadedAt: now,
+		tracing: os.Getenv("SEARCH_TRACE") == "1",
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.envelope && s.streaming {
+		// конверту нужен весь ответ, сбросы по пользователю он бы молча проглотил
+		panic("WithResponseEnvelope and WithStreaming cant be used together")
 	}
-	orderByStr := r.FormValue("order_by")
-	limitStr := r.FormValue("limit")
-	offsetStr := r.FormValue("offset")
+	warnUnknown := UnknownParamWarning(searchParams...)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if s.docs && r.Method == http.MethodGet && r.URL.RawQuery == "" {
+			serveDocs(w, r)
+			return
+		}
+		warnUnknown(http.HandlerFunc(s.search)).ServeHTTP(w, r)
+	})
+	get := []string{http.MethodGet}
+	post := []string{http.MethodPost}
+	s.handle("/search", warnUnknown(http.HandlerFunc(s.search)), routeDoc{
+		Summary: "Search users", Methods: []string{http.MethodGet, http.MethodPost},
+		SearchParams: true, Response: []User{},
+	})
+	s.handle("/search/count", http.HandlerFunc(s.searchCount), routeDoc{
+		Summary: "Count users matching the search filter", Methods: get, FilterParams: true, Response: 0,
+	})
+	s.handle("/search/explain", http.HandlerFunc(s.explain), routeDoc{
+		Summary: "Explain how a search is executed", Methods: post, SearchParams: true,
+		Response: map[string][]map[string]interface{}{},
+	})
+	s.handle("/stats/fields/", http.HandlerFunc(s.fieldStats), routeDoc{
+		Path: "/stats/fields/{field}", Summary: "Numeric statistics for a dataset field", Methods: get, Response: FieldStats{},
+	})
+	s.handle("/users/bulk", http.HandlerFunc(s.bulkUsers), routeDoc{
+		Summary: "Fetch users by ids", Methods: post, Request: bulkUsersRequest{}, Response: []*User{},
+	})
+	s.handle("/users", http.HandlerFunc(s.createUser), routeDoc{
+		Summary: "Create a user", Methods: post, Request: userUpdate{}, Response: User{},
+	})
+	s.handle("/users/", http.HandlerFunc(s.user), routeDoc{
+		Path: "/users/{id}", Summary: "Read, replace, patch or delete a user",
+		Methods: []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		Request: userUpdate{}, Response: User{},
+	})
+	s.handle("/changelog", http.HandlerFunc(s.changelogHandler), routeDoc{
+		Summary: "History of user changes", Methods: get, Response: []ChangeEntry{},
+		Params: []ParamDoc{
+			{Name: "user_id", Type: "int", Minimum: intPtr(0)},
+			{Name: "since", Type: "string", Constraints: "RFC 3339"},
+			{Name: "limit", Type: "int", Minimum: intPtr(1), Default: strconv.Itoa(defaultChangelogLimit)},
+		},
+	})
+	s.handle("/capabilities", http.HandlerFunc(s.capabilities), routeDoc{
+		Summary: "Optional features supported by the server", Methods: get, Response: ServerCapabilities{},
+	})
+	s.handle("/healthz", http.HandlerFunc(s.healthz), routeDoc{
+		Summary: "Health report", Methods: get, Response: HealthReport{},
+	})
+	s.handle("/openapi.json", http.HandlerFunc(s.openAPI), routeDoc{
+		Summary: "This specification", Methods: get, Response: map[string]interface{}{},
+	})
+	s.registerProfiling()
+	s.registerAdmin()
+	if s.aboutCipher != nil {
+		// с неверным ключом сервер был бы бесполезен, лучше узнать об этом сразу
+		if _, err := s.aboutCipher.decryptRows(s.ds.Rows); err != nil {
+			panic(fmt.Sprintf("cant decrypt dataset: %s", err))
+		}
+	}
+	if s.indexed {
+		s.index.Store(buildSearchIndex(s.data().Rows))
+	}
+	h := PanicRecoveryMiddleware(slog.Default())(s.mux)
+	if s.envelope {
+		h = responseEnvelope(h)
+	}
+	s.handler = TraceContextMiddleware(h)
+	return s
+}
 
-	limit, err := strconv.Atoi(limitStr)
+// data - снимок данных для поиска и выдачи, с включённым шифрованием About уже расшифрован
+func (s *SearchServer) data() DataSet {
+	ds := s.stored()
+	if s.aboutCipher != nil {
+		// проверено при загрузке, а сами мы пишем только то, что расшифруется
+		ds.Rows, _ = s.aboutCipher.decryptRows(ds.Rows)
+	}
+	return ds
+}
+
+// stored - данные в том виде, в каком хранятся, About может быть зашифрован
+func (s *SearchServer) stored() DataSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ds
+}
+
+// updateRows даёт fn копию строк и, если fn не вернула ошибку, подменяет ими данные сервера.
+// fn всегда видит расшифрованные строки, шифруются они уже при сохранении.
+// saved, если не nil, вызывается после успешного сохранения ещё под s.mu - так изменения
+// попадают в журнал в том же порядке, в каком сохранялись
+func (s *SearchServer) updateRows(fn func(rows []Row) ([]Row, error), saved func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := append([]Row(nil), s.ds.Rows...)
+	var err error
+	if s.aboutCipher != nil {
+		if rows, err = s.aboutCipher.decryptRows(rows); err != nil {
+			return err
+		}
+	}
+	rows, err = fn(rows)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "invalid limit"}`, http.StatusBadRequest)
+		return err
+	}
+	stats := computeFieldStats(rows)
+	if s.aboutCipher != nil {
+		if rows, err = s.aboutCipher.encryptRows(rows); err != nil {
+			return err
+		}
+	}
+	s.ds = DataSet{Rows: rows, Stats: stats}
+	s.version.Add(1)
+	if saved != nil {
+		saved()
+	}
+	return nil
+}
+
+func ServerSearch(w http.ResponseWriter, r *http.Request) {
+	NewSearchServer().ServeHTTP(w, r)
+}
+
+func (s *SearchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.active.Add(1)
+	defer s.active.Add(-1)
+	s.handler.ServeHTTP(w, r)
+}
+
+// searchMethods - методы, которые понимает /search
+var searchMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions}
+
+func (s *SearchServer) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		s.searchOptions(w, r)
 		return
 	}
-	if limit <= 0 {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "limit must be > 0"}`, http.StatusBadRequest)
+	if !parseSearchForm(w, r, searchMethods...) {
 		return
 	}
+	start := time.Now()
+	filter, err := s.parseSearchFilter(r)
+	if err != nil {
+		writeFilterError(w, err)
+		return
+	}
+	page, err := s.parseSearchPage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	parsed := traceEvent("parse", start, nil)
+
+	// версию берём до поиска, чтобы правка во время него не дала ETag новее данных
+	version := s.version.Load()
+	res := s.execute(filter, page)
+	users, total := res.users, res.total
+
+	if r.FormValue("debug") == "true" {
+		debug, _ := json.Marshal(map[string]interface{}{
+			"rows_scanned":    res.scanned,
+			"rows_filtered":   total,
+			"rows_after_sort": total,
+			"sort_algorithm":  res.sortAlgorithm,
+			"cache_hit":       false,
+			"index_used":      res.indexUsed,
+		})
+		// тело - массив пользователей, поэтому отладка едет в заголовке
+		w.Header().Set("X-Search-Debug", string(debug))
+	}
+
+	start = time.Now()
+	trace := func(bytes int) {
+		if s.tracing {
+			events := append(append([]TraceEvent{parsed}, res.steps...),
+				traceEvent("encode", start, map[string]interface{}{"bytes": bytes}))
+			s.traces.add(RequestTrace{At: time.Now().UTC(), Params: r.Form.Encode(), TraceID: traceID(r.Context()), Events: events})
+		}
+	}
+	var body []byte
+	written := 0
+	if s.streaming {
+		// при потоковой выдаче кодирование идёт вместе с записью, трассу пишем, когда ответ уже ушёл
+		defer func() { trace(written) }()
+	} else {
+		body, err = json.Marshal(users)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "cant encode users")
+			return
+		}
+		body = append(body, '\n')
+		trace(len(body))
+	}
+
+	// выборка без зерна каждый раз разная, ETag ей не положен
+	if s.searchETags && (page.sample == 0 || page.seed != 0) {
+		params := r.Form
+		if filter.tenant != "" {
+			params = url.Values{"tenant": {filter.tenant}}
+			for k, v := range r.Form {
+				params[k] = v
+			}
+		}
+		etag := searchETag(version, params)
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
 
-	offset, err := strconv.Atoi(offsetStr)
+	w.Header().Set("Content-Type", "application/json")
+	if !s.streaming {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if link := searchLinks(r, page, total); link != "" {
+		w.Header().Set("Link", link)
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if s.http2Push {
+		pushNextPage(w, r, page, total)
+	}
+	if s.streaming {
+		written, _ = streamUsers(w, users)
+		return
+	}
+	w.Write(body)
+}
+
+// parseSearchForm проверяет метод и разбирает параметры из урла и, для POST, из формы в теле.
+// При ошибке сам отвечает клиенту и возвращает false
+func parseSearchForm(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	allowed := false
+	for _, m := range methods {
+		allowed = allowed || r.Method == m
+	}
+	if !allowed {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if r.Method == http.MethodPost {
+		// параметры формы в теле дополняют параметры из урла
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/x-www-form-urlencoded" {
+			writeError(w, http.StatusUnsupportedMediaType, "expected application/x-www-form-urlencoded")
+			return false
+		}
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "cant parse form: "+err.Error())
+		return false
+	}
+	return true
+}
+
+type searchResult struct {
+	users         []User
+	total         int
+	scanned       int
+	indexUsed     bool
+	sortAlgorithm string
+	steps         []TraceEvent
+}
+
+// execute прогоняет фильтр, сортировку и пагинацию, замеряя каждый шаг
+func (s *SearchServer) execute(filter searchFilter, page searchPage) searchResult {
+	res := searchResult{sortAlgorithm: "pdqsort"}
+	switch {
+	case page.criteria != nil:
+		res.sortAlgorithm = "stable"
+	case page.orderBy == OrderByAsIs:
+		res.sortAlgorithm = "none"
+	}
+
+	start := time.Now()
+	rows, indexUsed := s.searchRows(filter)
+	users := filter.apply(rows)
+	res.scanned, res.indexUsed = len(rows), indexUsed
+	res.steps = append(res.steps, traceEvent("filter", start, map[string]interface{}{
+		"rows_in": len(rows), "rows_out": len(users), "index_used": indexUsed,
+	}))
+
+	if page.sortsBy("Score") {
+		start = time.Now()
+		in := len(users)
+		users = filter.score(users, page.minScore)
+		res.steps = append(res.steps, traceEvent("score", start, map[string]interface{}{
+			"rows_in": in, "rows_out": len(users), "min_score": page.minScore,
+		}))
+	}
+
+	if page.sample > 0 {
+		start = time.Now()
+		in := len(users)
+		seed := page.seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		users = reservoirSample(users, page.sample, rand.New(rand.NewSource(seed)))
+		res.steps = append(res.steps, traceEvent("sample", start, map[string]interface{}{
+			"rows_in": in, "rows_out": len(users), "seed": seed,
+		}))
+	}
+
+	start = time.Now()
+	if page.criteria != nil {
+		sortByCriteria(users, page.criteria, s.nameCompare())
+	} else {
+		sortUsers(users, page.orderField, page.orderBy, s.nameCompare())
+	}
+	res.steps = append(res.steps, traceEvent("sort", start, map[string]interface{}{
+		"algorithm": res.sortAlgorithm, "rows_in": len(users), "rows_out": len(users),
+	}))
+
+	start = time.Now()
+	res.total = len(users)
+	res.users = page.paginate(users)
+	res.steps = append(res.steps, traceEvent("paginate", start, map[string]interface{}{
+		"offset": page.offset, "limit": page.limit, "rows_in": res.total, "rows_out": len(res.users),
+	}))
+	return res
+}
+
+// reservoirSample - Algorithm R: k случайных пользователей за один проход, порядок исходного слайса не важен
+func reservoirSample(users []User, k int, rng *rand.Rand) []User {
+	if len(users) <= k {
+		return users
+	}
+	sample := make([]User, k)
+	copy(sample, users[:k])
+	for i := k; i < len(users); i++ {
+		if j := rng.Intn(i + 1); j < k {
+			sample[j] = users[i]
+		}
+	}
+	return sample
+}
+
+// explain выполняет поиск так же, как /search, но вместо пользователей отдаёт план с замерами шагов
+func (s *SearchServer) explain(w http.ResponseWriter, r *http.Request) {
+	if !parseSearchForm(w, r, http.MethodPost) {
+		return
+	}
+	filter, err := s.parseSearchFilter(r)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "invalid offset"}`, http.StatusBadRequest)
+		writeFilterError(w, err)
 		return
 	}
-	if offset < 0 {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "offset must be > 0"}`, http.StatusBadRequest)
+	page, err := s.parseSearchPage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	var steps []map[string]interface{}
+	for _, e := range s.execute(filter, page).steps {
+		step := map[string]interface{}{"step": e.Step, "duration_ns": e.Duration.Nanoseconds()}
+		for k, v := range e.Metadata {
+			step[k] = v
+		}
+		steps = append(steps, step)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"steps": steps})
+}
 
-	orderBy, err := strconv.Atoi(orderByStr)
+func (s *SearchServer) searchCount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	filter, err := s.parseSearchFilter(r)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "invalid order_by"}`, http.StatusBadRequest)
+		writeFilterError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	rows, _ := s.searchRows(filter)
+	json.NewEncoder(w).Encode(len(filter.apply(rows)))
+}
 
-	validOrderFields := map[string]bool{"Id": true, "Age": true, "Name": true}
-	if !validOrderFields[orderField] {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error":"OrderField `+orderField+` invalid"}`, http.StatusBadRequest)
+func writeError(w http.ResponseWriter, status int, msg string) {
+	body, _ := json.Marshal(map[string]string{"error": msg})
+	w.Header().Set("Content-Type", "application/json")
+	http.Error(w, string(body), status)
+}
+
+// searchFilter - то, что определяет, какие пользователи попадают в выдачу
+type searchFilter struct {
+	query          string
+	notQuery       string
+	queries        []string
+	gender         string
+	includeDeleted bool
+	sinceID        int
+	// keyset-пагинация, 0 - не задано
+	afterID, beforeID int
+	// непустой - видны только строки этого арендатора
+	tenant string
+}
+
+type queryTooLongError struct {
+	max, actual int
+}
+
+func (e *queryTooLongError) Error() string {
+	return "query too long"
+}
+
+func writeFilterError(w http.ResponseWriter, err error) {
+	var tooLong *queryTooLongError
+	if !errors.As(err, &tooLong) {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	body, _ := json.Marshal(map[string]interface{}{"error": tooLong.Error(), "max": tooLong.max, "actual": tooLong.actual})
+	w.Header().Set("Content-Type", "application/json")
+	http.Error(w, string(body), http.StatusBadRequest)
+}
+
+func (s *SearchServer) parseSearchFilter(r *http.Request) (searchFilter, error) {
+	f := searchFilter{
+		query:    r.FormValue("query"),
+		notQuery: r.FormValue("not_query"),
+		gender:   r.FormValue("gender"),
+	}
+	f.includeDeleted = r.FormValue("include_deleted") == "true"
+	f.queries = r.Form["queries"]
+	f.tenant, _ = tenantFromContext(r.Context())
+	if v := r.FormValue("since_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			return f, errors.New("invalid since_id")
+		}
+		f.sinceID = id
+	}
+	for name, dst := range map[string]*int{"after_id": &f.afterID, "before_id": &f.beforeID} {
+		if v := r.FormValue(name); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id < 0 {
+				return f, errors.New("invalid " + name)
+			}
+			*dst = id
+		}
+	}
+
+	if len(f.queries) > maxQueries {
+		return f, errors.New("too many queries")
+	}
+	maxLen := s.settings().MaxQueryLength
+	for _, q := range append([]string{f.query, f.notQuery}, f.queries...) {
+		if len(q) > maxLen {
+			return f, &queryTooLongError{max: maxLen, actual: len(q)}
+		}
+	}
+	if !s.DisableQueryNormalization {
+		f.query = NormalizeQuery(f.query)
+		f.notQuery = NormalizeQuery(f.notQuery)
+		queries := make([]string, len(f.queries))
+		for i, q := range f.queries {
+			queries[i] = NormalizeQuery(q)
+		}
+		f.queries = queries
+	}
+	if f.notQuery != "" && strings.EqualFold(f.query, f.notQuery) {
+		return f, errors.New("query and not_query are equal")
+	}
+	return f, nil
+}
 
+// NormalizeQuery обрезает пробелы по краям и схлопывает серии пробельных символов внутри в один пробел
+func NormalizeQuery(q string) string {
+	return strings.Join(strings.Fields(q), " ")
+}
+
+func (f searchFilter) apply(rows []Row) []User {
 	var users []User
-	for _, row := range dataset.Rows {
+	for _, row := range rows {
+		if f.afterID > 0 && row.ID <= f.afterID || f.beforeID > 0 && row.ID >= f.beforeID {
+			continue
+		}
+		if f.sinceID > 0 && row.ID <= f.sinceID {
+			continue
+		}
+		if f.tenant != "" && row.TenantID != f.tenant {
+			continue
+		}
 		name := row.FirstName + " " + row.LastName
-		if query == "" || strings.Contains(strings.ToLower(name), strings.ToLower(query)) ||
-			strings.Contains(strings.ToLower(row.About), strings.ToLower(query)) {
-			users = append(users, User{
-				Id:     row.ID,
-				Name:   name,
-				Age:    row.Age,
-				About:  row.About,
-				Gender: row.Gender,
-			})
+		if !f.includeDeleted && !row.DeletedAt.IsZero() {
+			continue
+		}
+		if f.gender != "" && row.Gender != f.gender {
+			continue
+		}
+		if f.notQuery != "" && rowMatches(name, row.About, f.notQuery) {
+			continue
+		}
+		if matchesAny(name, row.About, f.query, f.queries) {
+			users = append(users, rowToUser(row))
 		}
 	}
+	return users
+}
 
-	if orderBy != OrderByAsIs {
-		switch orderField {
-		case "Id":
-			sort.Slice(users, func(i, j int) bool {
-				if orderBy == OrderByDesc {
-					return users[i].Id > users[j].Id
-				}
-				return users[i].Id < users[j].Id
-			})
-		case "Age":
-			sort.Slice(users, func(i, j int) bool {
-				if orderBy == OrderByDesc {
-					return users[i].Age > users[j].Age
-				}
-				return users[i].Age < users[j].Age
-			})
-		case "Name":
-			sort.Slice(users, func(i, j int) bool {
-				if orderBy == OrderByDesc {
-					return users[i].Name > users[j].Name
-				}
-				return users[i].Name < users[j].Name
-			})
+// веса совпадений для релевантности: в имени совпадение важнее, чем в описании
+const (
+	nameMatchScore  = 10
+	aboutMatchScore = 2
+)
+
+// score проставляет релевантность по всем термам запроса и отбрасывает тех, у кого она ниже minScore
+func (f searchFilter) score(users []User, minScore float64) []User {
+	terms := append([]string{f.query}, f.queries...)
+	kept := users[:0]
+	for _, u := range users {
+		u.Score = 0
+		for _, term := range terms {
+			if term == "" {
+				continue
+			}
+			term = strings.ToLower(term)
+			if strings.Contains(strings.ToLower(u.Name), term) {
+				u.Score += nameMatchScore
+			}
+			if strings.Contains(strings.ToLower(u.About), term) {
+				u.Score += aboutMatchScore
+			}
+		}
+		if u.Score >= minScore {
+			kept = append(kept, u)
 		}
 	}
+	return kept
+}
 
-	if offset >= len(users) {
-		users = []User{}
-	} else {
-		users = users[offset:]
+func rowToUser(row Row) User {
+	return User{
+		Id:     row.ID,
+		Name:   row.FirstName + " " + row.LastName,
+		Age:    row.Age,
+		About:  row.About,
+		Gender: row.Gender,
+	}
+}
+
+// searchPage - сортировка и то, какой кусок отсортированной выдачи отдать
+type searchPage struct {
+	orderField string
+	orderBy    int
+	limit      int
+	offset     int
+	noLimit    bool
+	minScore   float64
+	sample     int
+	seed       int64
+	// order_criteria, если задан, заменяет orderField/orderBy
+	criteria []OrderCriterion
+}
+
+// sortsBy - участвует ли поле в сортировке, с учётом order_criteria
+func (p searchPage) sortsBy(field string) bool {
+	if p.criteria == nil {
+		return p.orderField == field
+	}
+	for _, c := range p.criteria {
+		if c.Field == field {
+			return true
+		}
 	}
+	return false
+}
 
-	if len(users) > limit {
-		users = users[:limit]
+func (s *SearchServer) parseSearchPage(r *http.Request) (searchPage, error) {
+	p := searchPage{orderField: s.resolveField(r.FormValue("order_field"))}
+	if p.orderField == "" {
+		p.orderField = "Name"
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	var err error
+	p.limit, err = strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		return p, errors.New("invalid limit")
+	}
+	p.noLimit = p.limit <= 0 && s.NoLimitAllowed
+	if p.limit <= 0 && !p.noLimit {
+		return p, errors.New("limit must be > 0")
+	}
+	if max := s.settings().MaxLimit; max > 0 && (p.noLimit || p.limit > max) {
+		p.limit, p.noLimit = max, false
+	}
+
+	p.offset, err = strconv.Atoi(r.FormValue("offset"))
+	if err != nil {
+		return p, errors.New("invalid offset")
+	}
+	if p.offset < 0 {
+		return p, errors.New("offset must be > 0")
+	}
+
+	p.orderBy, err = strconv.Atoi(r.FormValue("order_by"))
+	if err != nil {
+		return p, errors.New("invalid order_by")
+	}
+	if err := ValidateOrderBy(p.orderBy); err != nil {
+		return p, err
+	}
+
+	if v := r.FormValue("min_score"); v != "" {
+		p.minScore, err = strconv.ParseFloat(v, 64)
+		if err != nil || p.minScore < 0 {
+			return p, errors.New("min_score must be >= 0")
+		}
+	}
+
+	if v := r.FormValue("random_sample"); v != "" {
+		p.sample, err = strconv.Atoi(v)
+		if err != nil || p.sample < 0 {
+			return p, errors.New("random_sample must be >= 0")
+		}
+	}
+	if v := r.FormValue("seed"); v != "" {
+		p.seed, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return p, errors.New("invalid seed")
+		}
+	}
+
+	if v := r.FormValue("order_criteria"); v != "" {
+		if p.criteria, err = parseOrderCriteria(v, s.resolveField); err != nil {
+			return p, err
+		}
+	}
+
+	if !validOrderFields[p.orderField] {
+		return p, fmt.Errorf("OrderField %s invalid", p.orderField)
+	}
+	// по id без сортировки по id страницы keyset-пагинации не складываются
+	keyset := r.FormValue("after_id") != "" || r.FormValue("before_id") != ""
+	if keyset && (p.orderField != "Id" || p.criteria != nil) {
+		return p, errors.New("after_id and before_id require order_field=Id")
+	}
+	return p, nil
+}
+
+// resolveField переводит алиас поля во внутреннее имя, неизвестные имена возвращаются как есть
+func (s *SearchServer) resolveField(field string) string {
+	if internal, ok := s.FieldAliases[field]; ok {
+		return internal
+	}
+	return field
+}
+
+var validOrderFields = map[string]bool{"Id": true, "Age": true, "Name": true, "Score": true}
+
+func sortUsers(users []User, orderField string, orderBy int, compareNames func(a, b string) int) {
+	if orderBy == OrderByAsIs {
+		return
+	}
+	switch orderField {
+	case "Id":
+		sort.Slice(users, func(i, j int) bool {
+			if orderBy == OrderByDesc {
+				return users[i].Id > users[j].Id
+			}
+			return users[i].Id < users[j].Id
+		})
+	case "Age":
+		sort.Slice(users, func(i, j int) bool {
+			if orderBy == OrderByDesc {
+				return users[i].Age > users[j].Age
+			}
+			return users[i].Age < users[j].Age
+		})
+	case "Score":
+		sort.SliceStable(users, func(i, j int) bool {
+			if orderBy == OrderByDesc {
+				return users[i].Score > users[j].Score
+			}
+			return users[i].Score < users[j].Score
+		})
+	case "Name":
+		sort.Slice(users, func(i, j int) bool {
+			if orderBy == OrderByDesc {
+				return compareNames(users[i].Name, users[j].Name) > 0
+			}
+			return compareNames(users[i].Name, users[j].Name) < 0
+		})
+	}
+}
+
+func (p searchPage) paginate(users []User) []User {
+	if p.offset >= len(users) {
+		return []User{}
+	}
+	users = users[p.offset:]
+	if !p.noLimit && len(users) > p.limit {
+		users = users[:p.limit]
+	}
+	return users
+}
+
+const maxQueries = 10
+
+func matchesAny(name, about, query string, queries []string) bool {
+	if query == "" && len(queries) == 0 {
+		return true
+	}
+	if query != "" && rowMatches(name, about, query) {
+		return true
+	}
+	for _, q := range queries {
+		if rowMatches(name, about, q) {
+			return true
+		}
+	}
+	return false
+}
+
+func rowMatches(name, about, query string) bool {
+	query = strings.ToLower(query)
+	return strings.Contains(strings.ToLower(name), query) ||
+		strings.Contains(strings.ToLower(about), query)
 }
 
 func TestFindUsers(t *testing.T) {
@@ -387,3 +1243,825 @@ func TestFindUsers_ServerReturnsInvalidJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestDo_MutatorHeaders(t *testing.T) {
+	var gotTenant, gotToken string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = r.Header.Get("X-Tenant-ID")
+		gotToken = r.Header.Get("AccessToken")
+		ServerSearch(w, r)
+	}))
+	defer ts.Close()
+	sc := SearchClient{AccessToken: "test_token", URL: ts.URL}
+
+	res, err := sc.Do(context.Background(), SearchRequest{Limit: 1}, func(r *http.Request) {
+		r.Header.Set("X-Tenant-ID", "tenant-42")
+		r.Header.Set("AccessToken", "override_token")
+	})
+	require.NoError(t, err)
+	assert.Len(t, res.Users, 1)
+	assert.Equal(t, "tenant-42", gotTenant)
+	assert.Equal(t, "override_token", gotToken)
+
+	_, err = sc.Do(context.Background(), SearchRequest{Limit: 1}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "", gotTenant)
+	assert.Equal(t, "test_token", gotToken)
+}
+
+func TestSetHTTPHeader(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		ServerSearch(w, r)
+	}))
+	defer ts.Close()
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+
+	sc.SetHTTPHeader("x-app-version", "1.2.3")
+	sc.SetHTTPHeader("X-Client-ID", "billing")
+	sc.SetHTTPHeader("AccessToken", "stolen")
+	sc.SetHTTPHeader("Authorization", "Bearer stolen")
+	_, err := sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", got.Get("X-App-Version"))
+	assert.Equal(t, "billing", got.Get("X-Client-ID"))
+	assert.Equal(t, "test_token", got.Get("AccessToken"))
+	assert.Empty(t, got.Get("Authorization"))
+
+	// mutate идёт после постоянных заголовков
+	_, err = sc.Do(context.Background(), SearchRequest{Limit: 1}, func(r *http.Request) {
+		r.Header.Set("X-Client-ID", "override")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "override", got.Get("X-Client-ID"))
+
+	sc.DeleteHTTPHeader("X-App-Version")
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Empty(t, got.Get("X-App-Version"))
+	assert.Equal(t, "billing", got.Get("X-Client-ID"))
+}
+
+func TestGetLastResponse(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+	assert.Nil(t, sc.GetLastResponse())
+
+	res, err := sc.FindUsers(SearchRequest{Limit: 3, OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	last := sc.GetLastResponse()
+	require.NotNil(t, last)
+	assert.Equal(t, res, last)
+
+	// ошибка не затирает последний удачный ответ
+	_, err = sc.FindUsers(SearchRequest{Limit: 3, OrderField: "Unknown"})
+	require.Error(t, err)
+	assert.Equal(t, res, sc.GetLastResponse())
+
+	// изменения в отданной копии не попадают в клиента
+	last.Users[0].Name = "changed"
+	assert.NotEqual(t, "changed", sc.GetLastResponse().Users[0].Name)
+
+	sc.ClearLastResponse()
+	assert.Nil(t, sc.GetLastResponse())
+}
+
+func TestDo_BadURL(t *testing.T) {
+	sc := SearchClient{AccessToken: "test_token", URL: "://bad"}
+	_, err := sc.Do(context.Background(), SearchRequest{Limit: 1}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cant build request")
+}
+
+func TestServer_NoLimit(t *testing.T) {
+	cases := []struct {
+		name       string
+		opts       []ServerOption
+		limit      string
+		wantStatus int
+		wantLen    int
+	}{
+		{"MinusOneAllowed", []ServerOption{WithNoLimitAllowed(true)}, "-1", http.StatusOK, len(dataset.Rows)},
+		{"ZeroAllowed", []ServerOption{WithNoLimitAllowed(true)}, "0", http.StatusOK, len(dataset.Rows)},
+		{"MinusOneByDefault", nil, "-1", http.StatusBadRequest, 0},
+		{"ZeroByDefault", nil, "0", http.StatusBadRequest, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := httptest.NewServer(NewSearchServer(c.opts...))
+			defer ts.Close()
+
+			resp, err := http.Get(ts.URL + "?offset=0&order_by=0&limit=" + c.limit)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, c.wantStatus, resp.StatusCode)
+			if c.wantStatus != http.StatusOK {
+				return
+			}
+			var users []User
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&users))
+			assert.Len(t, users, c.wantLen)
+		})
+	}
+}
+
+func TestStreamUsers(t *testing.T) {
+	ts := httptest.NewServer(NewSearchServer(WithNoLimitAllowed(true)))
+	defer ts.Close()
+	sc := SearchClient{AccessToken: "test_token", URL: ts.URL}
+
+	cases := []struct {
+		name    string
+		req     SearchRequest
+		wantLen int
+	}{
+		{"NoLimit_ReturnsAll", SearchRequest{}, len(dataset.Rows)},
+		{"LimitAcrossPages", SearchRequest{Limit: 30, OrderField: "Id", OrderBy: OrderByAsc}, 30},
+		{"LimitAboveTotal", SearchRequest{Limit: 100, OrderField: "Id", OrderBy: OrderByAsc}, len(dataset.Rows)},
+		{"LimitWithOffset", SearchRequest{Limit: 10, Offset: 30, OrderField: "Id", OrderBy: OrderByAsc}, len(dataset.Rows) - 30},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var ids []int
+			err := sc.StreamUsers(context.Background(), c.req, func(u User) error {
+				ids = append(ids, u.Id)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Len(t, ids, c.wantLen)
+			if c.req.OrderField == "Id" {
+				for i := range ids {
+					assert.Equal(t, c.req.Offset+i, ids[i])
+				}
+			}
+		})
+	}
+
+	t.Run("NoLimitRejectedByDefaultServer", func(t *testing.T) {
+		ts := httptest.NewServer(NewSearchServer())
+		defer ts.Close()
+		sc := SearchClient{AccessToken: "test_token", URL: ts.URL}
+		err := sc.StreamUsers(context.Background(), SearchRequest{}, func(User) error { return nil })
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "limit must be > 0")
+	})
+
+	t.Run("CallbackErrorStops", func(t *testing.T) {
+		calls := 0
+		err := sc.StreamUsers(context.Background(), SearchRequest{Limit: 5}, func(User) error {
+			calls++
+			return errTest
+		})
+		assert.Equal(t, errTest, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestPaginateAll(t *testing.T) {
+	ts := NewTestServer(t)
+	require.Len(t, dataset.Rows, 35)
+
+	sc := ts.SearchClient("test_token")
+	users, err := sc.PaginateAll(context.Background(), SearchRequest{Limit: 5, OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	require.Len(t, users, 5)
+	for i, u := range users {
+		assert.Equal(t, i, u.Id)
+	}
+
+	users, err = sc.PaginateAll(context.Background(), SearchRequest{})
+	require.NoError(t, err)
+	assert.Len(t, users, len(dataset.Rows))
+
+	sc, err = NewSearchClient(ts.URL, "test_token", WithPaginateAllMax(10))
+	require.NoError(t, err)
+	_, err = sc.PaginateAll(context.Background(), SearchRequest{})
+	assert.ErrorIs(t, err, ErrTooManyResults)
+	_, err = sc.PaginateAll(context.Background(), SearchRequest{Limit: 20})
+	assert.ErrorIs(t, err, ErrTooManyResults)
+	users, err = sc.PaginateAll(context.Background(), SearchRequest{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, users, 10)
+
+	_, err = NewSearchClient(ts.URL, "test_token", WithPaginateAllMax(0))
+	assert.Error(t, err)
+}
+
+func TestFindUsers_NotQuery(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	res, err := sc.FindUsers(SearchRequest{Limit: 25, NotQuery: "Boyd Wolf"})
+	require.NoError(t, err)
+	assert.Len(t, res.Users, 25)
+	for _, u := range res.Users {
+		assert.NotEqual(t, "Boyd Wolf", u.Name)
+	}
+
+	all, err := sc.FindUsers(SearchRequest{Limit: 25, Query: "nulla"})
+	require.NoError(t, err)
+	filtered, err := sc.FindUsers(SearchRequest{Limit: 25, Query: "nulla", NotQuery: "boyd"})
+	require.NoError(t, err)
+	assert.Len(t, filtered.Users, len(all.Users)-1)
+	for _, u := range filtered.Users {
+		assert.NotContains(t, strings.ToLower(u.Name+u.About), "boyd")
+	}
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, Query: "Wolf", NotQuery: "wolf"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "query and not_query are equal")
+}
+
+func TestFindUsers_Queries(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	find := func(req SearchRequest) map[int]bool {
+		t.Helper()
+		req.Limit = 25
+		res, err := sc.FindUsers(req)
+		require.NoError(t, err)
+		require.False(t, res.NextPage)
+		ids := map[int]bool{}
+		for _, u := range res.Users {
+			ids[u.Id] = true
+		}
+		return ids
+	}
+
+	wolf := find(SearchRequest{Query: "Wolf"})
+	hilda := find(SearchRequest{Query: "Hilda"})
+	require.NotEmpty(t, wolf)
+	require.NotEmpty(t, hilda)
+
+	union := map[int]bool{}
+	for id := range wolf {
+		union[id] = true
+	}
+	for id := range hilda {
+		union[id] = true
+	}
+
+	assert.Equal(t, union, find(SearchRequest{Queries: []string{"Wolf", "Hilda"}}))
+	assert.Equal(t, union, find(SearchRequest{Query: "Wolf", Queries: []string{"Hilda"}}))
+
+	_, err := sc.FindUsers(SearchRequest{Limit: 1, Queries: make([]string, maxQueries+1)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "too many queries")
+}
+
+func TestSearch_Head(t *testing.T) {
+	ts := NewTestServer(t)
+	params := "/search?query=wolf&limit=5&offset=0&order_by=0"
+
+	head, err := http.Head(ts.URL + params)
+	require.NoError(t, err)
+	defer head.Body.Close()
+	require.Equal(t, http.StatusOK, head.StatusCode)
+	headBody, err := io.ReadAll(head.Body)
+	require.NoError(t, err)
+	assert.Empty(t, headBody)
+	assert.NotEmpty(t, head.Header.Get("Content-Length"))
+	assert.NotEmpty(t, head.Header.Get("X-Total-Count"))
+
+	get, err := http.Get(ts.URL + params)
+	require.NoError(t, err)
+	defer get.Body.Close()
+	getBody, err := io.ReadAll(get.Body)
+	require.NoError(t, err)
+	assert.Equal(t, get.Header.Get("X-Total-Count"), head.Header.Get("X-Total-Count"))
+	assert.Equal(t, strconv.Itoa(len(getBody)), head.Header.Get("Content-Length"))
+
+	var users []User
+	require.NoError(t, json.Unmarshal(getBody, &users))
+	total, err := strconv.Atoi(get.Header.Get("X-Total-Count"))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, total, len(users))
+}
+
+func TestValidateOrderBy(t *testing.T) {
+	for _, ob := range []int{OrderByAsc, OrderByAsIs, OrderByDesc} {
+		assert.NoError(t, ValidateOrderBy(ob))
+	}
+	assert.EqualError(t, ValidateOrderBy(42), "invalid order_by value: 42")
+
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+	_, err := sc.FindUsers(SearchRequest{Limit: 1, OrderBy: 42})
+	assert.EqualError(t, err, "invalid order_by value: 42")
+	assert.EqualError(t, SearchRequest{OrderBy: 42}.Validate(), "invalid order_by value: 42")
+
+	resp, err := http.Get(ts.URL + "/search?limit=1&offset=0&order_by=42")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"error":"invalid order_by value: 42"}`, string(body))
+}
+
+func TestSetDefaultRequest(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+	sc.SetDefaultRequest(SearchRequest{Limit: 25, Gender: GenderFemale})
+
+	genders := func(req SearchRequest) map[string]int {
+		t.Helper()
+		res, err := sc.FindUsers(req)
+		require.NoError(t, err)
+		out := map[string]int{}
+		for _, u := range res.Users {
+			out[u.Gender]++
+		}
+		return out
+	}
+
+	got := genders(SearchRequest{})
+	assert.Len(t, got, 1)
+	assert.NotZero(t, got[string(GenderFemale)])
+	ts.AssertNextRequest(t, SearchRequest{Limit: 26, Gender: GenderFemale})
+
+	got = genders(SearchRequest{Gender: GenderMale, Limit: 3})
+	assert.Equal(t, map[string]int{string(GenderMale): 3}, got)
+	ts.AssertNextRequest(t, SearchRequest{Limit: 4, Gender: GenderMale})
+
+	sc.ClearDefaultRequest()
+	got = genders(SearchRequest{Limit: 25})
+	assert.Len(t, got, 2)
+	ts.AssertNextRequest(t, SearchRequest{Limit: 26})
+}
+
+func TestSearch_MethodNotAllowed(t *testing.T) {
+	ts := NewTestServer(t)
+	for _, method := range []string{http.MethodPut, http.MethodDelete, http.MethodPatch} {
+		t.Run(method, func(t *testing.T) {
+			req, err := http.NewRequest(method, ts.URL+"/search?limit=1&offset=0&order_by=0", nil)
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+			assert.Equal(t, "GET, HEAD, POST, OPTIONS", resp.Header.Get("Allow"))
+		})
+	}
+}
+
+func TestFindUsers_RequestID(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("query") == "with-id" {
+			w.Header().Set("X-Request-ID", "req-12345")
+		}
+		ServerSearch(w, r)
+	}))
+	defer ts.Close()
+	sc := SearchClient{AccessToken: "test_token", URL: ts.URL}
+
+	res, err := sc.FindUsers(SearchRequest{Limit: 1, Query: "with-id"})
+	require.NoError(t, err)
+	assert.Equal(t, "req-12345", res.RequestID)
+
+	res, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "", res.RequestID)
+}
+
+func TestDataSetLoader_SmallDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.xml")
+	require.NoError(t, os.WriteFile(path, []byte(`<root></root>`), 0o644))
+
+	var logs bytes.Buffer
+	l := NewDataSetLoader(path)
+	l.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	ds, err := l.Load()
+	require.NoError(t, err)
+	assert.Empty(t, ds.Rows)
+	assert.Contains(t, logs.String(), "level=WARN")
+	assert.Contains(t, logs.String(), "dataset is suspiciously small")
+
+	logs.Reset()
+	l.FailOnSmallDataset = true
+	_, err = l.Load()
+	assert.ErrorIs(t, err, ErrDatasetTooSmall)
+	assert.Contains(t, logs.String(), "dataset is suspiciously small")
+
+	logs.Reset()
+	l = NewDataSetLoader("dataset.xml")
+	l.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	l.FailOnSmallDataset = true
+	l.MinDatasetRows = len(dataset.Rows)
+	ds, err = l.Load()
+	require.NoError(t, err)
+	assert.Len(t, ds.Rows, len(dataset.Rows))
+	assert.Empty(t, logs.String())
+}
+
+func TestLoadDataSet_Namespaced(t *testing.T) {
+	ds, err := LoadDataSet("testdata/dataset_ns.xml")
+	require.NoError(t, err)
+	require.Len(t, ds.Rows, 3)
+	assert.Equal(t, dataset.Rows[:3], ds.Rows)
+}
+
+func TestSearchCount(t *testing.T) {
+	ts := NewTestServer(t, WithNoLimitAllowed(true))
+	sc := ts.SearchClient("test_token")
+
+	count := func(params string) (int, int) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/search/count?" + params)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, resp.StatusCode
+		}
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		var n int
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&n))
+		return n, resp.StatusCode
+	}
+
+	for _, q := range []string{"", "wolf", "nulla", "DefinitelyNotFound"} {
+		t.Run("query="+q, func(t *testing.T) {
+			streamed := 0
+			err := sc.StreamUsers(context.Background(), SearchRequest{Query: q}, func(User) error {
+				streamed++
+				return nil
+			})
+			require.NoError(t, err)
+
+			n, code := count("query=" + q)
+			require.Equal(t, http.StatusOK, code)
+			assert.Equal(t, streamed, n)
+		})
+	}
+
+	_, code := count("query=a&not_query=A")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	resp, err := http.Post(ts.URL+"/search/count", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestDataSetLoader_DuplicateIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dups.xml")
+	require.NoError(t, os.WriteFile(path, []byte(`<root>
+		<row><id>1</id></row><row><id>7</id></row><row><id>1</id></row>
+		<row><id>3</id></row><row><id>7</id></row><row><id>1</id></row>
+	</root>`), 0o644))
+
+	_, err := LoadDataSet(path)
+	var dupErr *DuplicateIDError
+	require.ErrorAs(t, err, &dupErr)
+	assert.Equal(t, []int{1, 7}, dupErr.IDs)
+	assert.EqualError(t, err, "duplicate ids in dataset: 1, 7")
+
+	l := NewDataSetLoader(path)
+	l.AllowDuplicateIDs = true
+	ds, err := l.Load()
+	require.NoError(t, err)
+	assert.Len(t, ds.Rows, 6)
+}
+
+func TestFindUsers_Debug(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	res, err := sc.FindUsers(SearchRequest{Limit: 5, Debug: true})
+	require.NoError(t, err)
+	require.NotNil(t, res.Debug)
+	assert.Equal(t, float64(len(dataset.Rows)), res.Debug["rows_scanned"])
+	assert.Equal(t, float64(len(dataset.Rows)), res.Debug["rows_filtered"])
+	assert.Equal(t, "none", res.Debug["sort_algorithm"])
+	assert.Equal(t, false, res.Debug["cache_hit"])
+	assert.Equal(t, false, res.Debug["index_used"])
+
+	res, err = sc.FindUsers(SearchRequest{Limit: 5, Query: "wolf", OrderField: "Age", OrderBy: OrderByAsc, Debug: true})
+	require.NoError(t, err)
+	assert.Equal(t, float64(len(dataset.Rows)), res.Debug["rows_scanned"])
+	assert.Equal(t, float64(res.TotalCount), res.Debug["rows_filtered"])
+	assert.Equal(t, "pdqsort", res.Debug["sort_algorithm"])
+
+	res, err = sc.FindUsers(SearchRequest{Limit: 5})
+	require.NoError(t, err)
+	assert.Nil(t, res.Debug)
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Search-Debug", "{")
+		w.Write([]byte("[]"))
+	}))
+	defer bad.Close()
+	_, err = (&SearchClient{URL: bad.URL}).FindUsers(SearchRequest{Limit: 1, Debug: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cant unpack debug json")
+}
+
+func TestSearch_MaxQueryLength(t *testing.T) {
+	ts := NewTestServer(t)
+	get := func(path, query string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path + "?limit=1&offset=0&order_by=0&query=" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := get("/search", strings.Repeat("a", defaultMaxQueryLength))
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get("/search", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body := get("/search", strings.Repeat("a", defaultMaxQueryLength+1))
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.JSONEq(t, `{"error":"query too long","max":256,"actual":257}`, body)
+
+	code, body = get("/search/count", strings.Repeat("a", defaultMaxQueryLength+1))
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "query too long")
+
+	small := NewTestServer(t, WithMaxQueryLength(4))
+	_, err := small.SearchClient("test_token").FindUsers(SearchRequest{Limit: 1, Query: "wolf"})
+	require.NoError(t, err)
+	_, err = small.SearchClient("test_token").FindUsers(SearchRequest{Limit: 1, Queries: []string{"wolfs"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "query too long")
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	assert.Equal(t, "Boyd Wolf", NormalizeQuery("  Boyd  Wolf  "))
+	assert.Equal(t, "Boyd Wolf", NormalizeQuery("Boyd\t\n Wolf"))
+	assert.Equal(t, "", NormalizeQuery("   "))
+
+	find := func(ts *TestServer, q string) []User {
+		t.Helper()
+		resp, err := ts.SearchClient("test_token").FindUsers(SearchRequest{Limit: 5, Query: q})
+		require.NoError(t, err)
+		return resp.Users
+	}
+
+	users := find(NewTestServer(t), "  Boyd  Wolf  ")
+	require.Len(t, users, 1)
+	assert.Equal(t, "Boyd Wolf", users[0].Name)
+
+	assert.Empty(t, find(NewTestServer(t, WithDisableQueryNormalization(true)), "  Boyd  Wolf  "))
+}
+
+func TestSearch_SinceID(t *testing.T) {
+	ts := NewTestServer(t, WithNoLimitAllowed(true))
+	sc := ts.SearchClient("test_token")
+	collect := func(since int) []int {
+		t.Helper()
+		var ids []int
+		err := sc.StreamUsers(context.Background(), SearchRequest{SinceID: since, OrderField: "Id", OrderBy: OrderByAsc},
+			func(u User) error {
+				ids = append(ids, u.Id)
+				return nil
+			})
+		require.NoError(t, err)
+		return ids
+	}
+
+	all := collect(0)
+	assert.Len(t, all, len(dataset.Rows))
+	ts.AssertNextRequest(t, SearchRequest{Limit: -1, OrderField: "Id", OrderBy: OrderByAsc})
+
+	newer := collect(30)
+	require.NotEmpty(t, newer)
+	assert.Equal(t, 31, newer[0])
+	for _, id := range newer {
+		assert.Greater(t, id, 30)
+	}
+	ts.AssertNextRequest(t, SearchRequest{Limit: -1, OrderField: "Id", OrderBy: OrderByAsc, SinceID: 30})
+
+	_, err := sc.FindUsers(SearchRequest{Limit: 1, SinceID: -1})
+	require.Error(t, err)
+	resp, err := http.Get(ts.URL + "/search?limit=1&offset=0&order_by=0&since_id=x")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSearch_PostForm(t *testing.T) {
+	ts := NewTestServer(t)
+	read := func(resp *http.Response, err error) (int, string) {
+		t.Helper()
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	params := url.Values{
+		"limit": {"5"}, "offset": {"1"}, "order_by": {"1"}, "order_field": {"Age"},
+		"query": {"nulla"}, "queries": {"Boyd", "Wolf"},
+	}
+	wantCode, want := read(http.Get(ts.URL + "/search?" + params.Encode()))
+	require.Equal(t, http.StatusOK, wantCode)
+
+	code, got := read(http.PostForm(ts.URL+"/search", params))
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, want, got)
+
+	code, got = read(http.PostForm(ts.URL+"/search?limit=5&offset=1", url.Values{
+		"order_by": {"1"}, "order_field": {"Age"}, "query": {"nulla"}, "queries": {"Boyd", "Wolf"},
+	}))
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, want, got, "url and body params are merged")
+
+	code, _ = read(http.Post(ts.URL+"/search", "application/json", strings.NewReader(`{"limit": 5}`)))
+	assert.Equal(t, http.StatusUnsupportedMediaType, code)
+	code, _ = read(http.Post(ts.URL+"/search", "application/x-www-form-urlencoded", strings.NewReader("limit=%zz")))
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestSearchExplain(t *testing.T) {
+	ts := NewTestServer(t)
+	params := url.Values{
+		"limit": {"5"}, "offset": {"1"}, "order_by": {"1"}, "order_field": {"Age"}, "query": {"nulla"},
+	}
+
+	resp, err := http.PostForm(ts.URL+"/search", params)
+	require.NoError(t, err)
+	var users []User
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&users))
+	resp.Body.Close()
+
+	resp, err = http.PostForm(ts.URL+"/search/explain", params)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var plan struct {
+		Steps []map[string]interface{} `json:"steps"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&plan))
+
+	require.Len(t, plan.Steps, 3)
+	filter, sorting, paginate := plan.Steps[0], plan.Steps[1], plan.Steps[2]
+	assert.Equal(t, "filter", filter["step"])
+	assert.Equal(t, float64(len(dataset.Rows)), filter["rows_in"])
+	assert.Contains(t, filter, "duration_ns")
+	assert.Equal(t, "sort", sorting["step"])
+	assert.Equal(t, "pdqsort", sorting["algorithm"])
+	assert.Equal(t, "paginate", paginate["step"])
+	assert.Equal(t, float64(1), paginate["offset"])
+	assert.Equal(t, float64(5), paginate["limit"])
+	assert.Equal(t, float64(len(users)), paginate["rows_out"])
+
+	resp, err = http.Get(ts.URL + "/search/explain?" + params.Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp, err = http.PostForm(ts.URL+"/search/explain", url.Values{"limit": {"x"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestDataSet_Merge(t *testing.T) {
+	a := DataSet{Rows: []Row{{ID: 1, FirstName: "A", Age: 10}, {ID: 2, FirstName: "B", Age: 20}}}
+	b := DataSet{Rows: []Row{{ID: 3, FirstName: "C", Age: 30}}}
+
+	merged, err := a.Merge(b)
+	require.NoError(t, err)
+	assert.Equal(t, []Row{a.Rows[0], a.Rows[1], b.Rows[0]}, merged.Rows)
+	assert.Equal(t, float64(30), merged.Stats["age"].Max)
+	assert.Len(t, a.Rows, 2, "receiver is not modified")
+
+	conflict := DataSet{Rows: []Row{{ID: 2, FirstName: "B2"}, {ID: 1, FirstName: "A2"}}}
+	_, err = a.Merge(conflict)
+	var dupErr *DuplicateIDError
+	require.ErrorAs(t, err, &dupErr)
+	assert.Equal(t, []int{1, 2}, dupErr.IDs)
+
+	loose := a.MergeLoose(conflict)
+	assert.Equal(t, []Row{conflict.Rows[1], conflict.Rows[0]}, loose.Rows)
+
+	_, err = dataset.Merge(dataset)
+	require.ErrorAs(t, err, &dupErr)
+	assert.Len(t, dupErr.IDs, len(dataset.Rows))
+	assert.Equal(t, dataset, dataset.MergeLoose(dataset), "self merge keeps one row per id")
+}
+
+func TestSearch_MinScore(t *testing.T) {
+	rows := []Row{
+		{ID: 1, FirstName: "Wolf", LastName: "Hunter", About: "quiet"},
+		{ID: 2, FirstName: "Anna", LastName: "Lee", About: "likes the wolf"},
+		{ID: 3, FirstName: "Boyd", LastName: "Wolf", About: "wolf pack"},
+		{ID: 4, FirstName: "Nobody", LastName: "Else", About: "cats"},
+	}
+	ts := NewTestServer(t, WithDataSet(DataSet{Rows: rows}))
+	sc := ts.SearchClient("test_token")
+	find := func(req SearchRequest) []User {
+		t.Helper()
+		resp, err := sc.FindUsers(req)
+		require.NoError(t, err)
+		return resp.Users
+	}
+
+	users := find(SearchRequest{Limit: 10, Query: "wolf", OrderField: "Score", OrderBy: OrderByDesc})
+	require.Len(t, users, 3)
+	assert.Equal(t, []int{3, 1, 2}, []int{users[0].Id, users[1].Id, users[2].Id})
+	assert.Equal(t, []float64{12, 10, 2}, []float64{users[0].Score, users[1].Score, users[2].Score})
+
+	users = find(SearchRequest{Limit: 10, Query: "wolf", OrderField: "Score", OrderBy: OrderByDesc, MinScore: 5})
+	require.Len(t, users, 2)
+	for _, u := range users {
+		assert.GreaterOrEqual(t, u.Score, float64(nameMatchScore))
+	}
+
+	users = find(SearchRequest{Limit: 10, Query: "wolf", OrderField: "Id", OrderBy: OrderByAsc, MinScore: 5})
+	assert.Len(t, users, 3, "min_score is ignored without Score ordering")
+	assert.Zero(t, users[0].Score)
+
+	resp, err := http.Get(ts.URL + "/search?limit=1&offset=0&order_by=0&order_field=Score&min_score=-1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, MinScore: -1})
+	require.Error(t, err)
+}
+
+func TestSearch_RandomSample(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+	sample := func(seed int64) []int {
+		t.Helper()
+		resp, err := sc.FindUsers(SearchRequest{Limit: 25, RandomSample: 5, Seed: seed, OrderField: "Id", OrderBy: OrderByAsc})
+		require.NoError(t, err)
+		ids := []int{}
+		for _, u := range resp.Users {
+			ids = append(ids, u.Id)
+		}
+		return ids
+	}
+
+	first := sample(42)
+	require.Len(t, first, 5)
+	assert.True(t, sort.IntsAreSorted(first), "sample is sorted after sampling")
+	assert.Equal(t, first, sample(42))
+	assert.NotEqual(t, first, sample(7))
+	assert.Len(t, sample(0), 5)
+
+	resp, err := sc.FindUsers(SearchRequest{Limit: 25, Query: "Boyd", RandomSample: 5, Seed: 1})
+	require.NoError(t, err)
+	assert.Len(t, resp.Users, 1, "sample larger than result returns everything")
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, RandomSample: -1})
+	require.Error(t, err)
+	r, err := http.Get(ts.URL + "/search?limit=1&offset=0&order_by=0&random_sample=x")
+	require.NoError(t, err)
+	r.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, r.StatusCode)
+}
+
+func TestSearch_KeysetPagination(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	seen := map[int]int{}
+	req := SearchRequest{Limit: 4, OrderField: "Id", OrderBy: OrderByAsc}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, len(dataset.Rows), "pagination does not terminate")
+		res, err := sc.FindUsers(req)
+		require.NoError(t, err)
+		for _, u := range res.Users {
+			seen[u.Id]++
+		}
+		if !res.NextPage {
+			break
+		}
+		req.AfterID = res.Users[len(res.Users)-1].Id
+	}
+	require.Len(t, seen, len(dataset.Rows))
+	for id, n := range seen {
+		assert.Equal(t, 1, n, "user %d", id)
+	}
+
+	// предыдущая страница: перед Id 10 в обратном порядке
+	res, err := sc.FindUsers(SearchRequest{Limit: 3, BeforeID: 10, OrderField: "Id", OrderBy: OrderByDesc})
+	require.NoError(t, err)
+	assert.Equal(t, []int{9, 8, 7}, []int{res.Users[0].Id, res.Users[1].Id, res.Users[2].Id})
+
+	res, err = sc.FindUsers(SearchRequest{Limit: 25, AfterID: 3, BeforeID: 7, OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	assert.Len(t, res.Users, 3)
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, AfterID: 3, OrderField: "Name", OrderBy: OrderByAsc})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "require order_field=Id")
+	resp, err := http.Get(ts.URL + "/search?limit=1&offset=0&order_by=1&order_field=Id&order_criteria=" +
+		url.QueryEscape(`[{"field":"Age","dir":1}]`) + "&after_id=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, AfterID: -1, OrderField: "Id"})
+	require.Error(t, err)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// сервер не принимает больше за один запрос
+const maxBulkIDs = 100
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	errBulkUnsupported = errors.New("bulk lookup is not supported by server")
+)
+
+type bulkUsersRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// BulkFindUsersByIDs возвращает пользователей в том же порядке, что и ids, на месте ненайденных - nil.
+// Ходит в POST /users/bulk, а если сервер его не знает - перебирает всю выдачу поиска
+func (srv *SearchClient) BulkFindUsersByIDs(ctx context.Context, ids []int) ([]*User, error) {
+	unique := make([]int, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	found := make(map[int]*User, len(unique))
+	for start := 0; start < len(unique); start += maxBulkIDs {
+		end := start + maxBulkIDs
+		if end > len(unique) {
+			end = len(unique)
+		}
+		err := srv.bulkFetch(ctx, unique[start:end], found)
+		if errors.Is(err, errBulkUnsupported) {
+			found, err = srv.scanUsersByIDs(ctx, seen)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*User, len(ids))
+	for i, id := range ids {
+		result[i] = found[id]
+	}
+	return result, nil
+}
+
+func (srv *SearchClient) bulkFetch(ctx context.Context, ids []int, found map[int]*User) error {
+	payload, err := json.Marshal(bulkUsersRequest{IDs: ids})
+	if err != nil {
+		return fmt.Errorf("cant pack bulk request: %s", err)
+	}
+	u := srv.endpoint("/users/bulk")
+	resp, body, err := srv.send(ctx, http.MethodPost, u, payload, func(r *http.Request) {
+		r.Header.Set("Content-Type", "application/json")
+	})
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return errBulkUnsupported
+	case http.StatusUnauthorized:
+		return &AuthError{URL: u}
+	default:
+		return fmt.Errorf("bulk lookup failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	users := []*User{}
+	if err := json.Unmarshal(body, &users); err != nil {
+		return fmt.Errorf("cant unpack result json: %s", err)
+	}
+	if len(users) != len(ids) {
+		return fmt.Errorf("bulk lookup returned %d users for %d ids", len(users), len(ids))
+	}
+	for i, u := range users {
+		if u != nil {
+			found[ids[i]] = u
+		}
+	}
+	return nil
+}
+
+func (srv *SearchClient) scanUsersByIDs(ctx context.Context, ids map[int]bool) (map[int]*User, error) {
+	found := make(map[int]*User, len(ids))
+	// умолчания клиента тут ни при чём: их Query или Limit отсеяли бы часть нужных id
+	err := srv.stream(ctx, SearchRequest{Limit: math.MaxInt32, OrderField: "Id", OrderBy: OrderByAsc}, func(u User) error {
+		if ids[u.Id] {
+			found[u.Id] = &u
+		}
+		return nil
+	})
+	return found, err
+}
+
+// FindUserByID достаёт одного пользователя через GET /users/{id}, если его нет - ErrUserNotFound.
+// Удалённые пользователи тоже считаются ненайденными, если не передан includeDeleted
+func (srv *SearchClient) FindUserByID(ctx context.Context, id int, includeDeleted bool) (*User, error) {
+	user, _, err := srv.FindUserWithETag(ctx, id, includeDeleted)
+	return user, err
+}
+
+// FindUserWithETag - то же, что FindUserByID, но ещё отдаёт ETag прочитанной версии для UpdateUser
+func (srv *SearchClient) FindUserWithETag(ctx context.Context, id int, includeDeleted bool) (*User, string, error) {
+	u := srv.endpoint("/users/" + strconv.Itoa(id))
+	if includeDeleted {
+		u += "?include_deleted=true"
+	}
+	return srv.sendUser(ctx, http.MethodGet, u, "", nil)
+}
+
+// AuthError - сервер не принял токен (401)
+type AuthError struct {
+	URL string
+}
+
+func (e *AuthError) Error() string {
+	return "Bad AccessToken"
+}
+
+// ConflictError - пользователя изменили между чтением и записью, и сервер отверг правку по If-Match (412)
+type ConflictError struct {
+	ID  int
+	Msg string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("user %d was modified concurrently: %s", e.ID, e.Msg)
+}
+
+// userBody - тело PUT /users/{id}: сервер хранит имя и фамилию раздельно
+type userBody struct {
+	FirstName string
+	LastName  string
+	About     string
+	Gender    string
+	Age       int
+}
+
+// UpdateUser заменяет поля пользователя user.Id через PUT /users/{id} и возвращает то, что сохранил сервер.
+// etag - версия, которую видел вызывающий (см. FindUserWithETag), она уходит в If-Match: если с тех пор
+// пользователя успели изменить, возвращается *ConflictError. Name делится на имя и фамилию по первому пробелу
+func (srv *SearchClient) UpdateUser(ctx context.Context, user User, etag string) (*User, error) {
+	u := srv.endpoint("/users/" + strconv.Itoa(user.Id))
+	first, last, _ := strings.Cut(user.Name, " ")
+	payload, err := json.Marshal(userBody{
+		FirstName: first, LastName: last, About: user.About, Gender: user.Gender, Age: user.Age,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cant pack user: %s", err)
+	}
+	updated, _, err := srv.sendUser(ctx, http.MethodPut, u, etag, payload)
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		conflict.ID = user.Id
+	}
+	return updated, err
+}
+
+// sendUser делает запрос на адрес пользователя u (/users/{id}) и разбирает пользователя из ответа вместе с его ETag.
+// etag, если не пустой, уходит в If-Match, body - JSON-телом
+func (srv *SearchClient) sendUser(ctx context.Context, method, u, etag string, body []byte) (*User, string, error) {
+	resp, respBody, err := srv.send(ctx, method, u, body, func(r *http.Request) {
+		if body != nil {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if etag != "" {
+			r.Header.Set("If-Match", etag)
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, "", ErrUserNotFound
+	case http.StatusUnauthorized:
+		return nil, "", &AuthError{URL: u}
+	case http.StatusPreconditionFailed:
+		errResp := SearchErrorResponse{}
+		json.Unmarshal(respBody, &errResp)
+		return nil, "", &ConflictError{Msg: errResp.Error}
+	default:
+		return nil, "", fmt.Errorf("%s %s failed with status %d: %s", method, u, resp.StatusCode, respBody)
+	}
+
+	user := &User{}
+	if err := json.Unmarshal(respBody, user); err != nil {
+		return nil, "", fmt.Errorf("cant unpack result json: %s", err)
+	}
+	return user, resp.Header.Get("ETag"), nil
+}
+
+// endpoint строит адрес ручки сервера с тем же хостом, что и у URL поиска
+func (srv *SearchClient) endpoint(path string) string {
+	base := srv.baseURL()
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + path
+	}
+	u.Path = path
+	u.RawQuery = ""
+	return u.String()
+}
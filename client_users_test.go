@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bulkStubServer(t *testing.T, calls *[][]int) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/bulk" {
+			http.NotFound(w, r)
+			return
+		}
+		var req bulkUsersRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		*calls = append(*calls, req.IDs)
+		out := make([]*User, len(req.IDs))
+		for i, id := range req.IDs {
+			if id >= 0 && id < len(dataset.Rows) {
+				out[i] = &User{Id: id, Name: dataset.Rows[id].FirstName}
+			}
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestBulkFindUsersByIDs(t *testing.T) {
+	var calls [][]int
+	ts := bulkStubServer(t, &calls)
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+
+	users, err := sc.BulkFindUsersByIDs(context.Background(), []int{3, 1000, 1, 3})
+	require.NoError(t, err)
+	require.Len(t, users, 4)
+	assert.Equal(t, 3, users[0].Id)
+	assert.Nil(t, users[1])
+	assert.Equal(t, 1, users[2].Id)
+	assert.Same(t, users[0], users[3])
+	assert.Equal(t, [][]int{{3, 1000, 1}}, calls)
+
+	calls = nil
+	ids := make([]int, 250)
+	for i := range ids {
+		ids[i] = i
+	}
+	users, err = sc.BulkFindUsersByIDs(context.Background(), ids)
+	require.NoError(t, err)
+	require.Len(t, users, 250)
+	require.Len(t, calls, 3)
+	assert.Len(t, calls[0], maxBulkIDs)
+	assert.Len(t, calls[2], 50)
+}
+
+// сервер без POST /users/bulk, чтобы клиент ушёл в перебор выдачи
+func noBulkServer(t *testing.T) *SearchClient {
+	srv := NewSearchServer()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/bulk" {
+			http.NotFound(w, r)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return &SearchClient{AccessToken: "test_token", URL: ts.URL}
+}
+
+func TestBulkFindUsersByIDs_Fallback(t *testing.T) {
+	sc := noBulkServer(t)
+
+	users, err := sc.BulkFindUsersByIDs(context.Background(), []int{7, -1, 0, 7})
+	require.NoError(t, err)
+	require.Len(t, users, 4)
+	assert.Equal(t, 7, users[0].Id)
+	assert.Equal(t, dataset.Rows[7].FirstName+" "+dataset.Rows[7].LastName, users[0].Name)
+	assert.Nil(t, users[1])
+	assert.Equal(t, 0, users[2].Id)
+	assert.Equal(t, users[0], users[3])
+}
+
+func TestBulkFindUsersByIDs_FallbackIgnoresDefaults(t *testing.T) {
+	sc := noBulkServer(t)
+	sc.SetDefaultRequest(SearchRequest{Query: "nobody is called like this", Limit: 1})
+
+	users, err := sc.BulkFindUsersByIDs(context.Background(), []int{7, 0})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	require.NotNil(t, users[0])
+	require.NotNil(t, users[1])
+	assert.Equal(t, 7, users[0].Id)
+	assert.Equal(t, 0, users[1].Id)
+}
+
+func TestBulkFindUsersByIDs_Errors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("AccessToken") {
+		case "bad":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "short":
+			w.Write([]byte(`[]`))
+		case "garbage":
+			w.Write([]byte(`{`))
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	for token, want := range map[string]string{
+		"bad":     "Bad AccessToken",
+		"short":   "returned 0 users for 1 ids",
+		"garbage": "cant unpack result json",
+		"other":   "status 500",
+	} {
+		sc := &SearchClient{AccessToken: token, URL: ts.URL}
+		_, err := sc.BulkFindUsersByIDs(context.Background(), []int{1})
+		require.Error(t, err, token)
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+	ctx := context.Background()
+
+	_, etag, err := sc.FindUserWithETag(ctx, 4, false)
+	require.NoError(t, err)
+	want := User{Id: 4, Name: "New Name Jr", About: "a", Gender: "female", Age: 30}
+	u, err := sc.UpdateUser(ctx, want, etag)
+	require.NoError(t, err)
+	assert.Equal(t, &want, u)
+	u, etag, err = sc.FindUserWithETag(ctx, 4, false)
+	require.NoError(t, err)
+	assert.Equal(t, &want, u)
+
+	// сервер хранит имя и фамилию раздельно, так что имя из одного слова возвращается с пробелом
+	u, err = sc.UpdateUser(ctx, User{Id: 4, Name: "Cher", Gender: "female", Age: 30}, etag)
+	require.NoError(t, err)
+	assert.Equal(t, "Cher ", u.Name)
+
+	_, err = sc.UpdateUser(ctx, User{Id: 999, Name: "No One"}, etag)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestUpdateUser_ConcurrentWriter(t *testing.T) {
+	ts := NewTestServer(t)
+	ctx := context.Background()
+	mine, other := ts.SearchClient("test_token"), ts.SearchClient("test_token")
+
+	u, etag, err := mine.FindUserWithETag(ctx, 4, false)
+	require.NoError(t, err)
+
+	// пока мы правили свою копию, пользователя изменил кто-то другой
+	_, otherETag, err := other.FindUserWithETag(ctx, 4, false)
+	require.NoError(t, err)
+	_, err = other.UpdateUser(ctx, User{Id: 4, Name: "Their Edit", Gender: "male", Age: 50}, otherETag)
+	require.NoError(t, err)
+
+	u.Age = 99
+	_, err = mine.UpdateUser(ctx, *u, etag)
+	var conflict *ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, 4, conflict.ID)
+
+	saved, err := mine.FindUserByID(ctx, 4, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Their Edit", saved.Name, "concurrent edit is not overwritten")
+	assert.Equal(t, 50, saved.Age)
+}
+
+func TestUpdateUser_Errors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch token := r.Header.Get("AccessToken"); {
+		case token == "bad":
+			w.WriteHeader(http.StatusUnauthorized)
+		case token == "missing":
+			writeError(w, http.StatusNotFound, ErrUserNotFound.Error())
+		case token == "conflict":
+			assert.Equal(t, `"v1"`, r.Header.Get("If-Match"))
+			writeError(w, http.StatusPreconditionFailed, errPreconditionFailed.Error())
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+	update := func(token string) error {
+		t.Helper()
+		sc := &SearchClient{AccessToken: token, URL: ts.URL}
+		u, err := sc.UpdateUser(context.Background(), User{Id: 7, Name: "New Name"}, `"v1"`)
+		require.Error(t, err)
+		assert.Nil(t, u)
+		return err
+	}
+
+	assert.ErrorIs(t, update("missing"), ErrUserNotFound)
+
+	var authErr *AuthError
+	require.ErrorAs(t, update("bad"), &authErr)
+	assert.Equal(t, ts.URL+"/users/7", authErr.URL)
+
+	var conflict *ConflictError
+	require.ErrorAs(t, update("conflict"), &conflict)
+	assert.Equal(t, 7, conflict.ID)
+	assert.Equal(t, "user 7 was modified concurrently: user was modified", conflict.Error())
+
+	assert.Contains(t, update("other").Error(), "status 500")
+}
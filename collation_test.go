@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// WithSortCollation сортирует Name по правилам языка locale (BCP 47, например "sv" или "de-DE").
+// Пустая строка - побайтовое сравнение, непонятный locale сводится к ближайшему известному
+func WithSortCollation(locale string) ServerOption {
+	return func(s *SearchServer) {
+		s.collation = locale
+	}
+}
+
+// nameCompare возвращает сравнение имён для сортировки, Collator не потокобезопасный, поэтому свой на каждый запрос
+func (s *SearchServer) nameCompare() func(a, b string) int {
+	if s.collation == "" {
+		return strings.Compare
+	}
+	return collate.New(language.Make(s.collation)).CompareString
+}
+
+func TestWithSortCollation(t *testing.T) {
+	rows := []Row{
+		{ID: 1, FirstName: "Zed"},
+		{ID: 2, FirstName: "Ångström"},
+		{ID: 3, FirstName: "emil"},
+		{ID: 4, FirstName: "Adam"},
+	}
+	names := func(opts ...ServerOption) []string {
+		t.Helper()
+		ts := NewTestServer(t, append(opts, WithDataSet(DataSet{Rows: rows}))...)
+		resp, err := ts.SearchClient("test_token").FindUsers(SearchRequest{Limit: 10, OrderField: "Name", OrderBy: OrderByAsc})
+		require.NoError(t, err)
+		var out []string
+		for _, u := range resp.Users {
+			out = append(out, strings.TrimSpace(u.Name))
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"Adam", "Zed", "emil", "Ångström"}, names())
+	assert.Equal(t, []string{"Adam", "Zed", "emil", "Ångström"}, names(WithSortCollation("")))
+	assert.Equal(t, []string{"Adam", "emil", "Zed", "Ångström"}, names(WithSortCollation("sv")))
+	assert.Equal(t, []string{"Adam", "Ångström", "emil", "Zed"}, names(WithSortCollation("en")))
+}
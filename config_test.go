@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ServerConfig - настройки, которые можно менять без перезапуска через PATCH /admin/config
+type ServerConfig struct {
+	MaxLimit       int `json:"max_limit"`
+	MaxQueryLength int `json:"max_query_length"`
+}
+
+// configPatch - тело PATCH /admin/config, незаданные поля не меняются
+type configPatch struct {
+	MaxLimit       *int `json:"max_limit"`
+	MaxQueryLength *int `json:"max_query_length"`
+}
+
+// WithMaxLimit урезает limit в запросах до n, 0 - без ограничения
+func WithMaxLimit(n int) ServerOption {
+	return func(s *SearchServer) {
+		s.maxLimit = n
+	}
+}
+
+func (s *SearchServer) settings() ServerConfig {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return ServerConfig{MaxLimit: s.maxLimit, MaxQueryLength: s.MaxQueryLength}
+}
+
+// configHandler применяет частичные изменения настроек и отдаёт получившийся конфиг целиком
+func (s *SearchServer) configHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		w.Header().Set("Allow", "PATCH")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var patch configPatch
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if patch.MaxLimit != nil && *patch.MaxLimit < 0 {
+		writeError(w, http.StatusBadRequest, "max_limit must be >= 0")
+		return
+	}
+	if patch.MaxQueryLength != nil && *patch.MaxQueryLength <= 0 {
+		writeError(w, http.StatusBadRequest, "max_query_length must be > 0")
+		return
+	}
+
+	s.cfgMu.Lock()
+	if patch.MaxLimit != nil {
+		s.maxLimit = *patch.MaxLimit
+	}
+	if patch.MaxQueryLength != nil {
+		s.MaxQueryLength = *patch.MaxQueryLength
+	}
+	s.cfgMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.settings())
+}
+
+func patchConfig(t *testing.T, url, body string) (*http.Response, ServerConfig) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPatch, url+"/admin/config", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var cfg ServerConfig
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&cfg))
+	}
+	return resp, cfg
+}
+
+func TestAdminConfig(t *testing.T) {
+	ts := NewTestServer(t, WithManagementToken("admin"), WithMaxLimit(25))
+	sc := ts.SearchClient("test_token")
+	count := func() int {
+		t.Helper()
+		res, err := sc.FindUsers(SearchRequest{Limit: 25})
+		require.NoError(t, err)
+		return len(res.Users)
+	}
+	require.Equal(t, 25, count())
+
+	resp, cfg := patchConfig(t, ts.URL, `{"max_limit": 10}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, ServerConfig{MaxLimit: 10, MaxQueryLength: defaultMaxQueryLength}, cfg)
+	assert.Equal(t, 10, count())
+
+	_, cfg = patchConfig(t, ts.URL, `{"max_query_length": 3}`)
+	assert.Equal(t, ServerConfig{MaxLimit: 10, MaxQueryLength: 3}, cfg)
+	_, err := sc.FindUsers(SearchRequest{Limit: 1, Query: "Boyd"})
+	require.Error(t, err)
+
+	_, cfg = patchConfig(t, ts.URL, `{"max_limit": 25, "max_query_length": 256}`)
+	assert.Equal(t, ServerConfig{MaxLimit: 25, MaxQueryLength: 256}, cfg)
+	assert.Equal(t, 25, count())
+
+	for _, bad := range []string{`{"max_limit": -1}`, `{"max_query_length": 0}`, `{"rate_limit_rps": 5}`, `nope`} {
+		resp, _ := patchConfig(t, ts.URL, bad)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, bad)
+	}
+
+	resp = adminRequest(t, http.MethodPatch, ts.URL+"/admin/config", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = adminRequest(t, http.MethodGet, ts.URL+"/admin/config", "admin")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestMaxLimit_Paging(t *testing.T) {
+	ts := NewTestServer(t, WithDataSet(DataSet{Rows: dataset.Rows[:35]}), WithMaxLimit(10), WithNoLimitAllowed(true))
+	sc := ts.SearchClient("test_token")
+
+	res, err := sc.FindUsers(SearchRequest{Limit: 25, OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	assert.Len(t, res.Users, 10)
+	assert.Equal(t, 35, res.TotalCount)
+	assert.True(t, res.NextPage, "capped page is not the last one")
+
+	res, err = sc.FindUsers(SearchRequest{Limit: 25, Offset: 30, OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	assert.Len(t, res.Users, 5)
+	assert.False(t, res.NextPage)
+
+	all, err := sc.PaginateAll(context.Background(), SearchRequest{OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	require.Len(t, all, 35)
+	for i, u := range all {
+		assert.Equal(t, i, u.Id)
+	}
+
+	var streamed []int
+	err = sc.StreamUsers(context.Background(), SearchRequest{OrderField: "Id", OrderBy: OrderByAsc}, func(u User) error {
+		streamed = append(streamed, u.Id)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, streamed, 35)
+	assert.Equal(t, 34, streamed[34])
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// CountUsers возвращает, сколько пользователей подходит под фильтры req, через GET /search/count.
+// Сортировка и пагинация в req на результат не влияют
+func (srv *SearchClient) CountUsers(ctx context.Context, req SearchRequest) (int, error) {
+	req = srv.withDefaults(req)
+	u := srv.endpoint("/search/count") + "?" + req.values().Encode()
+	resp, body, err := srv.send(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return 0, &AuthError{URL: u}
+	default:
+		return 0, fmt.Errorf("count failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	var count int
+	if err := json.Unmarshal(body, &count); err != nil {
+		return 0, fmt.Errorf("cant unpack count json: %s", err)
+	}
+	return count, nil
+}
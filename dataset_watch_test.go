@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// сколько ждать тишины после последней записи в файл, прежде чем перечитывать
+const defaultReloadDebounce = 200 * time.Millisecond
+
+// WatchingDatasetLoader перечитывает датасет, когда файл меняется: следит за ним через fsnotify,
+// а не проверяет mtime на каждом запросе. Серия записей подряд даёт одну перезагрузку
+type WatchingDatasetLoader struct {
+	*DataSetLoader
+	Debounce time.Duration
+}
+
+func NewWatchingDatasetLoader(path string) *WatchingDatasetLoader {
+	return &WatchingDatasetLoader{DataSetLoader: NewDataSetLoader(path), Debounce: defaultReloadDebounce}
+}
+
+// Watch начинает следить за файлом и вызывает onLoad с каждым удачно перечитанным датасетом.
+// Неудачная загрузка только пишется в Logger, последний хороший датасет остаётся в силе.
+// Следит за каталогом, а не за файлом: редакторы часто пишут новый файл и переименовывают его поверх старого.
+// Слежение прекращается с отменой ctx
+func (l *WatchingDatasetLoader) Watch(ctx context.Context, onLoad func(DataSet)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(l.Path)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == path && ev.Has(fsnotify.Write|fsnotify.Create) {
+					debounce = time.After(l.Debounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				l.Logger.Warn("dataset watcher error", "path", l.Path, "error", err)
+			case <-debounce:
+				debounce = nil
+				ds, err := l.Load()
+				if err != nil {
+					l.Logger.Error("dataset reload failed", "path", l.Path, "error", err)
+					continue
+				}
+				onLoad(ds)
+			}
+		}
+	}()
+	return nil
+}
+
+// setDataSet целиком подменяет данные сервера, например после перезагрузки файла.
+// Данные, которые не расшифровать ключом сервера, не принимаются
+func (s *SearchServer) setDataSet(ds DataSet) error {
+	if s.aboutCipher != nil {
+		if _, err := s.aboutCipher.decryptRows(ds.Rows); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.ds = ds
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	s.version.Add(1)
+	if s.indexed {
+		s.index.Store(buildSearchIndex(s.data().Rows))
+	}
+	return nil
+}
+
+func TestWatchingDatasetLoader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	write := func(names ...string) {
+		t.Helper()
+		data := "<root>"
+		for i, name := range names {
+			data += "<row><id>" + string(rune('0'+i)) + "</id><first_name>" + name + "</first_name></row>"
+		}
+		require.NoError(t, os.WriteFile(path, []byte(data+"</root>"), 0o644))
+	}
+	write("Initial")
+
+	l := NewWatchingDatasetLoader(path)
+	ds, err := l.Load()
+	require.NoError(t, err)
+	s := NewSearchServer(WithDataSet(ds), WithSearchIndex())
+
+	var mu sync.Mutex
+	reloads := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, l.Watch(ctx, func(ds DataSet) {
+		mu.Lock()
+		reloads++
+		mu.Unlock()
+		assert.NoError(t, s.setDataSet(ds))
+	}))
+
+	names := func() []string {
+		var out []string
+		for _, row := range s.data().Rows {
+			out = append(out, row.FirstName)
+		}
+		return out
+	}
+
+	// несколько быстрых записей подряд - одна перезагрузка с последним содержимым
+	write("First")
+	write("Second", "Third")
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"Second", "Third"}, names())
+	}, 300*time.Millisecond+l.Debounce, 10*time.Millisecond)
+	time.Sleep(l.Debounce)
+	mu.Lock()
+	assert.Equal(t, 1, reloads)
+	mu.Unlock()
+
+	// битый файл не роняет текущие данные
+	require.NoError(t, os.WriteFile(path, []byte("<root><row>"), 0o644))
+	time.Sleep(2 * l.Debounce)
+	assert.Equal(t, []string{"Second", "Third"}, names())
+
+	// после отмены ctx изменения больше не подхватываются
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	write("Ignored")
+	time.Sleep(2 * l.Debounce)
+	assert.Equal(t, []string{"Second", "Third"}, names())
+}
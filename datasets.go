@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DatasetInfo - один датасет из GET /datasets
+type DatasetInfo struct {
+	Name     string    `json:"name"`
+	Rows     int       `json:"rows"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// ListDatasets спрашивает у сервера с несколькими датасетами, какие у него есть, список отсортирован по имени
+func (srv *SearchClient) ListDatasets(ctx context.Context) ([]DatasetInfo, error) {
+	u := srv.endpoint("/datasets")
+	resp, body, err := srv.send(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, &AuthError{URL: u}
+	default:
+		return nil, fmt.Errorf("datasets request failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	datasets := []DatasetInfo{}
+	if err := json.Unmarshal(body, &datasets); err != nil {
+		return nil, fmt.Errorf("cant unpack datasets json: %s", err)
+	}
+	return datasets, nil
+}
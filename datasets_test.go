@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MultiDatasetServer раздаёт несколько датасетов, каждый своим SearchServer:
+// /datasets/{name}/... уходит в сервер name без префикса, GET /datasets перечисляет их все
+type MultiDatasetServer struct {
+	mu      sync.RWMutex
+	servers map[string]*SearchServer
+}
+
+func NewMultiDatasetServer() *MultiDatasetServer {
+	return &MultiDatasetServer{servers: map[string]*SearchServer{}}
+}
+
+// Register добавляет датасет под именем name, уже занятое имя переходит к новому серверу
+func (m *MultiDatasetServer) Register(name string, s *SearchServer) {
+	m.mu.Lock()
+	m.servers[name] = s
+	m.mu.Unlock()
+}
+
+func (m *MultiDatasetServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/datasets" {
+		m.list(w, r)
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/datasets/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	m.mu.RLock()
+	s := m.servers[name]
+	m.mu.RUnlock()
+	if s == nil {
+		writeError(w, http.StatusNotFound, "unknown dataset "+name)
+		return
+	}
+	http.StripPrefix("/datasets/"+name, s).ServeHTTP(w, r)
+}
+
+func (m *MultiDatasetServer) list(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	m.mu.RLock()
+	infos := make([]DatasetInfo, 0, len(m.servers))
+	for name, s := range m.servers {
+		s.mu.RLock()
+		infos = append(infos, DatasetInfo{Name: name, Rows: len(s.ds.Rows), LoadedAt: s.loadedAt})
+		s.mu.RUnlock()
+	}
+	m.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+func TestListDatasets(t *testing.T) {
+	m := NewMultiDatasetServer()
+	m.Register("default", NewSearchServer())
+	m.Register("small", NewSearchServer(WithDataSet(DataSet{Rows: []Row{
+		{ID: 0, FirstName: "Anna", LastName: "A", Gender: "female"},
+		{ID: 1, FirstName: "Boris", LastName: "B", Gender: "male"},
+	}})))
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+	start := time.Now()
+
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL + "/datasets/small/"}
+	datasets, err := sc.ListDatasets(context.Background())
+	require.NoError(t, err)
+	require.Len(t, datasets, 2)
+	assert.Equal(t, "default", datasets[0].Name)
+	assert.Equal(t, len(dataset.Rows), datasets[0].Rows)
+	assert.Equal(t, "small", datasets[1].Name)
+	assert.Equal(t, 2, datasets[1].Rows)
+	for _, d := range datasets {
+		assert.WithinDuration(t, start, d.LoadedAt, time.Second)
+	}
+
+	// поиск клиента с тем же адресом уходит в свой датасет
+	resp, err := sc.FindUsers(SearchRequest{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, resp.Users, 2)
+
+	for path, want := range map[string]int{"/datasets/missing/": 404, "/other": 404} {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, want, resp.StatusCode, path)
+	}
+
+	plain := httptest.NewServer(NewSearchServer())
+	defer plain.Close()
+	_, err = (&SearchClient{URL: plain.URL}).ListDatasets(context.Background())
+	assert.ErrorContains(t, err, "status 404", "single dataset server has no discovery")
+}
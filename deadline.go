@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// доли оставшегося бюджета на каждую попытку FindUsersWithDeadline, последняя забирает всё
+var deadlineAttemptShares = []float64{0.25, 0.5, 1}
+
+const deadlineRetryPause = 10 * time.Millisecond
+
+// FindUsersWithDeadline делает до трёх попыток FindUsers так, чтобы все вместе уложились в totalBudget.
+// Первой попытке достаётся 25% бюджета, второй - 50% оставшегося, третьей - весь остаток,
+// так что медленный первый ответ (например, сервер встал на GC) не съедает весь бюджет.
+// Между попытками пауза 10ms. Возвращается ошибка последней попытки, а если бюджета не хватило
+// ни на одну (например, totalBudget <= 0) - context.DeadlineExceeded
+func (srv *SearchClient) FindUsersWithDeadline(ctx context.Context, req SearchRequest, totalBudget time.Duration) (*SearchResponse, error) {
+	// невалидный запрос повторять бессмысленно
+	if err := srv.withDefaults(req).Validate(); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(totalBudget)
+	var lastErr error
+	for i, share := range deadlineAttemptShares {
+		if i > 0 {
+			select {
+			case <-time.After(deadlineRetryPause):
+			case <-ctx.Done():
+				return nil, lastErr
+			}
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, time.Duration(float64(remaining)*share))
+		resp, err := srv.Do(attemptCtx, req, nil)
+		cancel()
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = context.DeadlineExceeded
+	}
+	return nil, lastErr
+}
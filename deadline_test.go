@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindUsersWithDeadline(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// первый запрос "застревает" дольше, чем 25% бюджета
+		if calls.Add(1) == 1 {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		json.NewEncoder(w).Encode([]User{{Id: 1}})
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+	start := time.Now()
+	resp, err := sc.FindUsersWithDeadline(context.Background(), SearchRequest{Limit: 5}, 400*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, resp.Users, 1)
+	assert.EqualValues(t, 2, calls.Load())
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestFindUsersWithDeadline_BudgetExhausted(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+	start := time.Now()
+	_, err := sc.FindUsersWithDeadline(context.Background(), SearchRequest{Limit: 5}, 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout")
+	assert.EqualValues(t, 3, calls.Load())
+	assert.Less(t, time.Since(start), 300*time.Millisecond)
+
+	_, err = sc.FindUsersWithDeadline(context.Background(), SearchRequest{Limit: -1}, time.Second)
+	require.Error(t, err)
+	assert.EqualValues(t, 3, calls.Load(), "invalid request is not sent")
+
+	for _, budget := range []time.Duration{0, -time.Second} {
+		resp, err := sc.FindUsersWithDeadline(context.Background(), SearchRequest{Limit: 5}, budget)
+		assert.ErrorIs(t, err, context.DeadlineExceeded, budget)
+		assert.Nil(t, resp)
+	}
+	assert.EqualValues(t, 3, calls.Load(), "no budget - no attempts")
+}
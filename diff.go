@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+)
+
+// FieldChange - одно отличие между двумя запросами
+type FieldChange struct {
+	Field    string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// Diff возвращает отличающиеся экспортируемые поля запросов в порядке их объявления в SearchRequest
+func Diff(a, b SearchRequest) []FieldChange {
+	var changes []FieldChange
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		oldV, newV := va.Field(i).Interface(), vb.Field(i).Interface()
+		if !reflect.DeepEqual(oldV, newV) {
+			changes = append(changes, FieldChange{Field: f.Name, OldValue: oldV, NewValue: newV})
+		}
+	}
+	return changes
+}
+
+const (
+	UserDiffAdd    = "add"
+	UserDiffRemove = "remove"
+	UserDiffChange = "change"
+)
+
+// UserDiff - изменение одного пользователя между двумя выдачами, у add нет Old, у remove нет New
+type UserDiff struct {
+	Op  string
+	Old *User
+	New *User
+}
+
+// DiffResults сравнивает две выдачи по Id пользователей, результат отсортирован по Id.
+// nil-ответ считается пустым
+func (srv *SearchClient) DiffResults(a, b *SearchResponse) []UserDiff {
+	before, after := usersByID(a), usersByID(b)
+	ids := make([]int, 0, len(before)+len(after))
+	for id := range before {
+		ids = append(ids, id)
+	}
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	var diffs []UserDiff
+	for _, id := range ids {
+		old, hadOld := before[id]
+		cur, hasNew := after[id]
+		switch {
+		case !hadOld:
+			diffs = append(diffs, UserDiff{Op: UserDiffAdd, New: &cur})
+		case !hasNew:
+			diffs = append(diffs, UserDiff{Op: UserDiffRemove, Old: &old})
+		case old != cur:
+			diffs = append(diffs, UserDiff{Op: UserDiffChange, Old: &old, New: &cur})
+		}
+	}
+	return diffs
+}
+
+func usersByID(resp *SearchResponse) map[int]User {
+	if resp == nil {
+		return map[int]User{}
+	}
+	m := make(map[int]User, len(resp.Users))
+	for _, u := range resp.Users {
+		m[u.Id] = u
+	}
+	return m
+}
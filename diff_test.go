@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a := SearchRequest{Limit: 10, Query: "wolf", Queries: []string{"a"}, OrderField: "Age"}
+	assert.Empty(t, Diff(a, a))
+
+	b := a
+	b.Queries = []string{"a"}
+	assert.Empty(t, Diff(a, b), "equal slices are not a change")
+
+	b.Limit = 20
+	b.Query = "boyd"
+	b.Gender = GenderMale
+	assert.Equal(t, []FieldChange{
+		{Field: "Limit", OldValue: 10, NewValue: 20},
+		{Field: "Query", OldValue: "wolf", NewValue: "boyd"},
+		{Field: "Gender", OldValue: Gender(""), NewValue: GenderMale},
+	}, Diff(a, b))
+
+	c := a
+	c.Queries = []string{"a", "b"}
+	c.IncludeDeleted = true
+	assert.Equal(t, []FieldChange{
+		{Field: "Queries", OldValue: []string{"a"}, NewValue: []string{"a", "b"}},
+		{Field: "IncludeDeleted", OldValue: false, NewValue: true},
+	}, Diff(a, c))
+}
+
+func TestDiffResults(t *testing.T) {
+	var sc SearchClient
+	kept := User{Id: 1, Name: "Kept"}
+	removed := User{Id: 2, Name: "Removed"}
+	changed := User{Id: 3, Name: "Changed", Age: 20}
+	aged := changed
+	aged.Age = 21
+	added := User{Id: 4, Name: "Added"}
+
+	a := &SearchResponse{Users: []User{changed, kept, removed}}
+	b := &SearchResponse{Users: []User{added, kept, aged}}
+	assert.Equal(t, []UserDiff{
+		{Op: UserDiffRemove, Old: &removed},
+		{Op: UserDiffChange, Old: &changed, New: &aged},
+		{Op: UserDiffAdd, New: &added},
+	}, sc.DiffResults(a, b))
+
+	assert.Empty(t, sc.DiffResults(a, a))
+	assert.Equal(t, []UserDiff{{Op: UserDiffAdd, New: &kept}}, sc.DiffResults(nil, &SearchResponse{Users: []User{kept}}))
+}
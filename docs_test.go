@@ -0,0 +1,53 @@
+package main
+
+import (
+	_ "embed"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// WithDocs включает страницу с описанием ручек на GET / без параметров, поиск на / с параметрами работает как раньше
+func WithDocs(enabled bool) ServerOption {
+	return func(s *SearchServer) {
+		s.docs = enabled
+	}
+}
+
+func serveDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
+
+func TestWithDocs(t *testing.T) {
+	get := func(url string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	ts := NewTestServer(t, WithDocs(true))
+	resp, body := get(ts.URL + "/")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	for _, s := range []string{"order_field", "limit", "offset"} {
+		assert.Contains(t, body, s)
+	}
+
+	users, err := ts.SearchClient("test_token").FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, users.Users, 1)
+
+	resp, _ = get(NewTestServer(t).URL + "/")
+	assert.NotContains(t, resp.Header.Get("Content-Type"), "text/html")
+}
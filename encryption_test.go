@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// aboutCipher шифрует Row.About в AES-GCM: base64 от nonce и шифротекста
+type aboutCipher struct {
+	aead cipher.AEAD
+	// откуда брать nonce, crypto/rand
+	nonces io.Reader
+}
+
+func newAboutCipher(key []byte) (*aboutCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aboutCipher{aead: aead, nonces: rand.Reader}, nil
+}
+
+// WithAboutEncryption хранит About зашифрованным ключом key (16, 24 или 32 байта - AES-128/192/256).
+// Датасет с самого начала должен быть зашифрован этим ключом, иначе NewSearchServer паникует.
+// Поиск и выдача видят расшифрованный текст, правки и импорт шифруются при сохранении,
+// экспорт /dataset.xml и /dataset.json отдаёт About как хранится. Неверный ключ - паника при создании опции
+func WithAboutEncryption(key []byte) ServerOption {
+	c, err := newAboutCipher(key)
+	if err != nil {
+		panic(fmt.Sprintf("invalid about encryption key: %s", err))
+	}
+	return func(s *SearchServer) {
+		s.aboutCipher = c
+	}
+}
+
+func (c *aboutCipher) encrypt(plain string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(c.nonces, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+func (c *aboutCipher) decrypt(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < c.aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, data := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// encryptRows и decryptRows возвращают копию rows, сами rows не трогают
+func (c *aboutCipher) encryptRows(rows []Row) ([]Row, error) {
+	return c.mapAbout(rows, c.encrypt)
+}
+
+func (c *aboutCipher) decryptRows(rows []Row) ([]Row, error) {
+	return c.mapAbout(rows, c.decrypt)
+}
+
+func (c *aboutCipher) mapAbout(rows []Row, fn func(string) (string, error)) ([]Row, error) {
+	out := make([]Row, len(rows))
+	for i, row := range rows {
+		about, err := fn(row.About)
+		if err != nil {
+			return nil, fmt.Errorf("about of user %d: %w", row.ID, err)
+		}
+		row.About = about
+		out[i] = row
+	}
+	return out, nil
+}
+
+func TestAboutEncryption(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	c, err := newAboutCipher(key)
+	require.NoError(t, err)
+	plain := []Row{
+		{ID: 0, FirstName: "Anna", LastName: "A", Gender: "female", About: "secret diary of a wolf"},
+		{ID: 1, FirstName: "Boris", LastName: "B", Gender: "male", About: "plain text"},
+	}
+	encrypted, err := c.encryptRows(plain)
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted[0].About, "wolf")
+	assert.Equal(t, "secret diary of a wolf", plain[0].About, "source rows are not modified")
+
+	ts := NewTestServer(t, WithDataSet(DataSet{Rows: encrypted}), WithAboutEncryption(key), WithManagementToken("admin"))
+	sc := ts.SearchClient("test_token")
+
+	resp, err := sc.FindUsers(SearchRequest{Limit: 5, Query: "diary"})
+	require.NoError(t, err)
+	require.Len(t, resp.Users, 1)
+	assert.Equal(t, "secret diary of a wolf", resp.Users[0].About)
+	u, etag, err := sc.FindUserWithETag(context.Background(), 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, "plain text", u.About)
+
+	// правка сохраняется зашифрованной и находится по новому тексту
+	u, err = sc.UpdateUser(context.Background(), User{Id: 1, Name: "Boris B", Gender: "male", About: "new hobby: chess"}, etag)
+	require.NoError(t, err)
+	assert.Equal(t, "new hobby: chess", u.About)
+	resp, err = sc.FindUsers(SearchRequest{Limit: 5, Query: "chess"})
+	require.NoError(t, err)
+	assert.Len(t, resp.Users, 1)
+
+	exported := adminRequest(t, http.MethodGet, ts.URL+"/dataset.json", "admin")
+	defer exported.Body.Close()
+	var rows []Row
+	require.NoError(t, json.NewDecoder(exported.Body).Decode(&rows))
+	require.Len(t, rows, 2)
+	assert.NotContains(t, rows[1].About, "chess")
+	about, err := c.decrypt(rows[1].About)
+	require.NoError(t, err)
+	assert.Equal(t, "new hobby: chess", about)
+
+	// открытый текст вместо шифротекста или чужой ключ - сразу паника
+	assert.Panics(t, func() { NewSearchServer(WithDataSet(DataSet{Rows: plain}), WithAboutEncryption(key)) })
+	assert.Panics(t, func() {
+		NewSearchServer(WithDataSet(DataSet{Rows: encrypted}), WithAboutEncryption([]byte("another-key-0123")))
+	})
+	assert.Panics(t, func() { WithAboutEncryption([]byte("short")) })
+	// индекс строится по расшифрованному тексту
+	s := NewSearchServer(WithDataSet(DataSet{Rows: encrypted}), WithAboutEncryption(key), WithSearchIndex())
+	assert.Error(t, s.setDataSet(DataSet{Rows: plain}))
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?limit=5&offset=0&order_by=0&query=wolf", nil))
+	assert.Contains(t, rec.Body.String(), "secret diary of a wolf")
+}
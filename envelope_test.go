@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// WithResponseEnvelope заворачивает JSON-ответы в {"data": ..., "error": ..., "meta": ...}.
+// SearchClient такие ответы не понимает, режим для сторонних клиентов.
+// Конверт собирается из ответа целиком, поэтому вместе с WithStreaming NewSearchServer паникует
+func WithResponseEnvelope(enabled bool) ServerOption {
+	return func(s *SearchServer) {
+		s.envelope = enabled
+	}
+}
+
+type envelopeError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type envelopeMeta struct {
+	Total int  `json:"total"`
+	Page  int  `json:"page"`
+	Next  bool `json:"next"`
+}
+
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Error *envelopeError  `json:"error"`
+	Meta  *envelopeMeta   `json:"meta,omitempty"`
+}
+
+// bufferedWriter придерживает ответ обработчика, чтобы его можно было переписать целиком
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedWriter) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// Push буфер не трогает: обещанная страница - отдельный запрос, и в конверт её завернут там
+func (b *bufferedWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := b.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// responseEnvelope переписывает ответы в конверт. Не-JSON (документация, pprof), HEAD и пустые ответы
+// проходят как есть. meta есть только у ответов с X-Total-Count, то есть у поиска
+func responseEnvelope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buf := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		raw := bytes.TrimSpace(buf.body.Bytes())
+		var env envelope
+		switch {
+		case buf.status >= http.StatusBadRequest:
+			var errResp struct {
+				Error string `json:"error"`
+			}
+			msg := string(raw)
+			if json.Unmarshal(raw, &errResp) == nil && errResp.Error != "" {
+				msg = errResp.Error
+			}
+			env = envelope{Data: json.RawMessage("null"), Error: &envelopeError{Code: buf.status, Message: msg}}
+		case len(raw) > 0 && json.Valid(raw):
+			env = envelope{Data: raw}
+			if total, err := strconv.Atoi(w.Header().Get("X-Total-Count")); err == nil {
+				env.Meta = searchMeta(r, total)
+			}
+		default:
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		body, _ := json.Marshal(env)
+		body = append(body, '\n')
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(buf.status)
+		w.Write(body)
+	})
+}
+
+// searchMeta - номер страницы с единицы и есть ли что-то после неё
+func searchMeta(r *http.Request, total int) *envelopeMeta {
+	limit, _ := strconv.Atoi(r.FormValue("limit"))
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+	meta := &envelopeMeta{Total: total, Page: 1}
+	if limit > 0 {
+		meta.Page = offset/limit + 1
+		meta.Next = offset+limit < total
+	}
+	return meta
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	get := func(ts *TestServer, path string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+	const page = "/search?limit=2&offset=2&order_by=1&order_field=Id"
+	const bad = "/search?limit=2&offset=0&order_by=1&order_field=About"
+
+	plain := NewTestServer(t)
+	resp, users := get(plain, page)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(users, "["))
+	resp, errBody := get(plain, bad)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.JSONEq(t, `{"error":"OrderField About invalid"}`, errBody)
+
+	wrapped := NewTestServer(t, WithResponseEnvelope(true))
+	resp, body := get(wrapped, page)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	total := len(dataset.Rows)
+	assert.JSONEq(t, `{"data":`+users+`,"error":null,"meta":{"total":`+strconv.Itoa(total)+`,"page":2,"next":true}}`, body)
+
+	resp, body = get(wrapped, bad)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"data":null,"error":{"code":400,"message":"OrderField About invalid"}}`, body)
+
+	resp, body = get(wrapped, "/search?limit=50&offset=0&order_by=0")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"next":false`)
+
+	resp, body = get(wrapped, "/users/1")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"data":{`)
+	assert.NotContains(t, body, `"meta"`)
+}
+
+func TestResponseEnvelope_PushAndStreaming(t *testing.T) {
+	s := NewSearchServer(WithResponseEnvelope(true), WithHTTP2Push(true))
+	rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?limit=2&offset=0&order_by=1&order_field=Id", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"data":[`)
+	require.Len(t, rec.pushed, 1, "envelope must not hide http.Pusher")
+
+	assert.PanicsWithValue(t, "WithResponseEnvelope and WithStreaming cant be used together", func() {
+		NewSearchServer(WithResponseEnvelope(true), WithStreaming(true))
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// WithSearchETags включает ETag на выдаче поиска: "v<версия данных>-<хеш параметров>".
+// Любая правка данных меняет версию, так что клиент по ETag понимает, что весь его кеш устарел
+func WithSearchETags(enabled bool) ServerOption {
+	return func(s *SearchServer) {
+		s.searchETags = enabled
+	}
+}
+
+func searchETag(version uint64, params url.Values) string {
+	h := fnv.New64a()
+	h.Write([]byte(params.Encode()))
+	return fmt.Sprintf(`"v%d-%x"`, version, h.Sum64())
+}
+
+// etagServer отдаёт датасет с ETag текущей версии, 304 на совпадающий If-None-Match
+// и 412 на устаревший, как будто датасет перечитали
+type etagServer struct {
+	mu          sync.Mutex
+	version     string
+	always412   bool
+	conditional []string
+}
+
+func (s *etagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	version := s.version
+	inm := r.Header.Get("If-None-Match")
+	s.conditional = append(s.conditional, inm)
+	always412 := s.always412
+	s.mu.Unlock()
+
+	if always412 {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if inm != "" {
+		if inm == version {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("ETag", version)
+	ServerSearch(w, r)
+}
+
+func TestETagCache_RetryOnStaleETag(t *testing.T) {
+	es := &etagServer{version: `"v1"`}
+	ts := httptest.NewServer(es)
+	defer ts.Close()
+
+	sc, err := NewSearchClient(ts.URL, "test_token", WithETagCache())
+	require.NoError(t, err)
+
+	first, err := sc.FindUsers(SearchRequest{Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, first.Users, 3)
+
+	cached, err := sc.FindUsers(SearchRequest{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, first, cached)
+
+	es.mu.Lock()
+	es.version = `"v2"`
+	es.mu.Unlock()
+
+	reloaded, err := sc.FindUsers(SearchRequest{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, first.Users, reloaded.Users)
+
+	again, err := sc.FindUsers(SearchRequest{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, reloaded, again)
+
+	assert.Equal(t, []string{"", `"v1"`, `"v1"`, "", `"v2"`}, es.conditional)
+}
+
+func TestETagCache_Always412(t *testing.T) {
+	es := &etagServer{version: `"v1"`}
+	ts := httptest.NewServer(es)
+	defer ts.Close()
+
+	sc, err := NewSearchClient(ts.URL, "test_token", WithETagCache())
+	require.NoError(t, err)
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+
+	es.mu.Lock()
+	es.always412 = true
+	es.mu.Unlock()
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "precondition failed")
+	assert.Equal(t, []string{"", `"v1"`, ""}, es.conditional)
+}
+
+func TestETagCache_Disabled(t *testing.T) {
+	es := &etagServer{version: `"v1"`}
+	ts := httptest.NewServer(es)
+	defer ts.Close()
+
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+	for i := 0; i < 2; i++ {
+		_, err := sc.FindUsers(SearchRequest{Limit: 1})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"", ""}, es.conditional)
+
+	ts304 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer ts304.Close()
+	sc.URL = ts304.URL
+	_, err := sc.FindUsers(SearchRequest{Limit: 1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nothing cached")
+}
+
+func TestETagCache_InvalidatedOnDataChange(t *testing.T) {
+	var statuses []int
+	var mu sync.Mutex
+	srv := NewSearchServer(WithSearchETags(true))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		srv.ServeHTTP(rec, r)
+		if r.URL.Path == "/" {
+			mu.Lock()
+			statuses = append(statuses, rec.status)
+			mu.Unlock()
+		}
+	}))
+	defer ts.Close()
+
+	sc, err := NewSearchClient(ts.URL, "test_token", WithETagCache())
+	require.NoError(t, err)
+	find := func(q string) *SearchResponse {
+		t.Helper()
+		resp, err := sc.FindUsers(SearchRequest{Limit: 2, Query: q})
+		require.NoError(t, err)
+		return resp
+	}
+	cached := func() int {
+		sc.mu.RLock()
+		defer sc.mu.RUnlock()
+		return len(sc.etags)
+	}
+
+	first := find("nulla")
+	find("Boyd")
+	assert.Equal(t, first, find("nulla"))
+	assert.Equal(t, []int{200, 200, 304}, statuses)
+	assert.Equal(t, 2, cached())
+
+	resp, _ := userRequest(t, http.MethodGet, ts.URL+"/users/0", "", "")
+	resp, _ = userRequest(t, http.MethodPatch, ts.URL+"/users/0", resp.Header.Get("ETag"), `{"Age": 99}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	find("nulla")
+	assert.Equal(t, 200, statuses[len(statuses)-1])
+	assert.Equal(t, 1, cached(), "entries of the old version are evicted")
+
+	sc.InvalidateCache()
+	assert.Equal(t, 0, cached())
+	find("nulla")
+	assert.Equal(t, []int{200, 200, 304, 200, 200}, statuses)
+
+	assert.Equal(t, "v12", etagDataVersion(`W/"v12-abc"`))
+	assert.Empty(t, etagDataVersion(`"v1"`))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PlanStep - один шаг выполнения поиска: filter, score, sample, sort или paginate
+type PlanStep struct {
+	Name string `json:"step"`
+	// у шагов, которые не меняют набор строк, RowsIn == RowsOut
+	RowsIn     int   `json:"rows_in"`
+	RowsOut    int   `json:"rows_out"`
+	DurationNS int64 `json:"duration_ns"`
+}
+
+// QueryPlan - как сервер выполнил поиск, отдаётся POST /search/explain
+type QueryPlan struct {
+	Steps []PlanStep `json:"steps"`
+}
+
+// TotalDuration - сколько заняли все шаги вместе, без разбора параметров и сети
+func (p *QueryPlan) TotalDuration() time.Duration {
+	var total int64
+	for _, s := range p.Steps {
+		total += s.DurationNS
+	}
+	return time.Duration(total)
+}
+
+// Explain выполняет поиск на сервере через POST /search/explain и вместо пользователей возвращает план с замерами шагов.
+// Запрос проходит те же умолчания и проверки, что и в Do, но limit не урезается и лишняя запись не запрашивается
+func (srv *SearchClient) Explain(ctx context.Context, req SearchRequest) (*QueryPlan, error) {
+	req = srv.withDefaults(req)
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	u := srv.endpoint("/search/explain")
+	resp, body, err := srv.send(ctx, http.MethodPost, u, []byte(req.values().Encode()), func(r *http.Request) {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, &AuthError{URL: u}
+	case http.StatusBadRequest:
+		errResp := SearchErrorResponse{}
+		if err := json.Unmarshal(body, &errResp); err != nil {
+			return nil, fmt.Errorf("cant unpack error json: %s", err)
+		}
+		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
+	default:
+		return nil, fmt.Errorf("explain failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	plan := &QueryPlan{}
+	if err := json.Unmarshal(body, plan); err != nil {
+		return nil, fmt.Errorf("cant unpack plan json: %s", err)
+	}
+	return plan, nil
+}
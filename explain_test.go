@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+	req := SearchRequest{Limit: 5, OrderField: "Age", OrderBy: OrderByAsc}
+
+	plan, err := sc.Explain(context.Background(), req)
+	require.NoError(t, err)
+	steps := map[string]PlanStep{}
+	var names []string
+	var total time.Duration
+	for _, s := range plan.Steps {
+		steps[s.Name] = s
+		names = append(names, s.Name)
+		total += time.Duration(s.DurationNS)
+	}
+	assert.Equal(t, []string{"filter", "sort", "paginate"}, names)
+	assert.Equal(t, len(dataset.Rows), steps["filter"].RowsIn)
+	assert.Equal(t, len(dataset.Rows), steps["filter"].RowsOut)
+	assert.Equal(t, len(dataset.Rows), steps["paginate"].RowsIn)
+	assert.LessOrEqual(t, steps["paginate"].RowsOut, req.Limit)
+	assert.Equal(t, total, plan.TotalDuration())
+	assert.Empty(t, ts.received, "explain must not hit the search endpoint")
+
+	_, err = sc.Explain(context.Background(), SearchRequest{Limit: -1})
+	assert.Error(t, err, "request is validated before sending")
+	_, err = sc.Explain(context.Background(), SearchRequest{Limit: 1, OrderField: "Unknown"})
+	assert.Error(t, err)
+
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer denied.Close()
+	_, err = (&SearchClient{URL: denied.URL}).Explain(context.Background(), req)
+	assert.EqualError(t, err, "Bad AccessToken")
+}
+
+func TestQueryPlan_TotalDuration(t *testing.T) {
+	assert.Zero(t, (&QueryPlan{}).TotalDuration())
+	plan := &QueryPlan{Steps: []PlanStep{{Name: "filter", DurationNS: 1500}, {Name: "sort", DurationNS: 500}}}
+	assert.Equal(t, 2*time.Microsecond, plan.TotalDuration())
+}
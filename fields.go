@@ -0,0 +1,63 @@
+package main
+
+import "fmt"
+
+// UserField - имя поля User, как оно называется в JSON ответа сервера
+type UserField string
+
+const (
+	UserFieldID     UserField = "Id"
+	UserFieldName   UserField = "Name"
+	UserFieldAge    UserField = "Age"
+	UserFieldAbout  UserField = "About"
+	UserFieldGender UserField = "Gender"
+	// есть в датасете, но в User пока не отдаётся, поэтому на выдачу не влияет
+	UserFieldIsActive UserField = "IsActive"
+)
+
+// AllUserFields возвращает все известные поля
+func AllUserFields() []UserField {
+	return []UserField{UserFieldID, UserFieldName, UserFieldAge, UserFieldAbout, UserFieldGender, UserFieldIsActive}
+}
+
+func validateFields(fields []UserField) error {
+	for _, f := range fields {
+		switch f {
+		case UserFieldID, UserFieldName, UserFieldAge, UserFieldAbout, UserFieldGender, UserFieldIsActive:
+		default:
+			return fmt.Errorf("unknown field: %q", f)
+		}
+	}
+	return nil
+}
+
+// projectUsers оставляет у пользователей только fields, остальные поля обнуляются. Пустой fields - всё как есть
+func projectUsers(users []User, fields []UserField) []User {
+	if len(fields) == 0 {
+		return users
+	}
+	keep := make(map[UserField]bool, len(fields))
+	for _, f := range fields {
+		keep[f] = true
+	}
+	out := make([]User, len(users))
+	for i, u := range users {
+		out[i].Score = u.Score
+		if keep[UserFieldID] {
+			out[i].Id = u.Id
+		}
+		if keep[UserFieldName] {
+			out[i].Name = u.Name
+		}
+		if keep[UserFieldAge] {
+			out[i].Age = u.Age
+		}
+		if keep[UserFieldAbout] {
+			out[i].About = u.About
+		}
+		if keep[UserFieldGender] {
+			out[i].Gender = u.Gender
+		}
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchRequest_ValidateFields(t *testing.T) {
+	require.NoError(t, SearchRequest{Fields: AllUserFields()}.Validate())
+	require.NoError(t, SearchRequest{}.Validate())
+
+	err := SearchRequest{Fields: []UserField{UserFieldName, "avout"}}.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "avout")
+}
+
+func TestFindUsers_Fields(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	full, err := sc.FindUsers(SearchRequest{Limit: 3, OrderField: "Id", OrderBy: OrderByDesc})
+	require.NoError(t, err)
+	resp, err := sc.FindUsers(SearchRequest{Limit: 3, OrderField: "Id", OrderBy: OrderByDesc,
+		Fields: []UserField{UserFieldID, UserFieldName}})
+	require.NoError(t, err)
+	require.Len(t, resp.Users, 3)
+	for i, u := range resp.Users {
+		assert.Equal(t, User{Id: full.Users[i].Id, Name: full.Users[i].Name}, u)
+	}
+	assert.Equal(t, full.NextPage, resp.NextPage)
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1, Fields: []UserField{"avout"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// maxQueryStringBytes - самая длинная строка запроса в урле, которую ещё стоит разбирать
+const maxQueryStringBytes = 8192
+
+// FormParsingMiddleware разбирает форму до обработчика, ограничив тело maxBodyBytes, а строку запроса - maxQueryStringBytes.
+// Битая или слишком большая форма сразу получает 400, обработчики дальше читают уже разобранные r.Form
+func FormParsingMiddleware(maxBodyBytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.URL.RawQuery) > maxQueryStringBytes {
+				writeError(w, http.StatusBadRequest, "query string too long")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+			// ParseMultipartForm прячет ошибку ParseForm за ErrNotMultipart, поэтому обычную форму разбираем отдельно
+			err := r.ParseForm()
+			if err == nil {
+				err = r.ParseMultipartForm(maxBodyBytes)
+				if errors.Is(err, http.ErrNotMultipart) {
+					err = nil
+				}
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "cant parse form: "+err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestFormParsingMiddleware(t *testing.T) {
+	h := FormParsingMiddleware(1024)(NewSearchServer())
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	form := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/?limit=1&offset=0&order_by=0", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	rec := do(httptest.NewRequest(http.MethodGet, "/?limit=5&query="+strings.Repeat("a", maxQueryStringBytes), nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "query string too long")
+
+	rec = do(httptest.NewRequest(http.MethodGet, "/?limit=5&offset=0&order_by=0&query=Boyd", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = do(form(url.Values{"query": {"Boyd"}}.Encode()))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = do(form("query=%zz"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(form("query=" + strings.Repeat("a", 2048)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HealthReport - ответ GET /healthz
+type HealthReport struct {
+	Status          string    `json:"status"`
+	DatasetRows     int       `json:"dataset_rows"`
+	DatasetLoadedAt time.Time `json:"dataset_loaded_at"`
+	CacheHitRate    float64   `json:"cache_hit_rate"`
+	ActiveRequests  int       `json:"active_requests"`
+	// в JSON - наносекунды
+	Uptime time.Duration `json:"uptime"`
+}
+
+// DegradedError - сервер отвечает, но считает себя нездоровым, подробности в Report
+type DegradedError struct {
+	Report *HealthReport
+}
+
+func (e *DegradedError) Error() string {
+	return fmt.Sprintf("server is %s", e.Report.Status)
+}
+
+// Healthcheck запрашивает отчёт о здоровье сервера. Если Status не "ok" - вместе с отчётом возвращается *DegradedError
+func (srv *SearchClient) Healthcheck(ctx context.Context) (*HealthReport, error) {
+	resp, body, err := srv.send(ctx, http.MethodGet, srv.endpoint("/healthz"), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// нездоровый сервер отвечает 503, но с тем же отчётом
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("healthcheck failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	report := &HealthReport{}
+	if err := json.Unmarshal(body, report); err != nil {
+		return nil, fmt.Errorf("cant unpack health json: %s", err)
+	}
+	if report.Status != "ok" {
+		return report, &DegradedError{Report: report}
+	}
+	return report, nil
+}
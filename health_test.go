@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// healthz отвечает 503, если данных нет совсем - искать не по чему
+func (s *SearchServer) healthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.mu.RLock()
+	report := HealthReport{
+		Status:          "ok",
+		DatasetRows:     len(s.ds.Rows),
+		DatasetLoadedAt: s.loadedAt,
+		ActiveRequests:  int(s.active.Load()),
+		Uptime:          time.Since(s.startedAt),
+	}
+	s.mu.RUnlock()
+
+	status := http.StatusOK
+	if report.DatasetRows == 0 {
+		report.Status = "degraded"
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+func TestHealthcheck(t *testing.T) {
+	before := time.Now()
+	ts := NewTestServer(t)
+	report, err := ts.SearchClient("test_token").Healthcheck(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ok", report.Status)
+	assert.Equal(t, len(dataset.Rows), report.DatasetRows)
+	assert.WithinDuration(t, before, report.DatasetLoadedAt, time.Minute)
+	assert.Equal(t, 1, report.ActiveRequests, "the healthcheck itself")
+	assert.Greater(t, report.Uptime, time.Duration(0))
+
+	empty := NewTestServer(t, WithDataSet(DataSet{}))
+	report, err = empty.SearchClient("test_token").Healthcheck(context.Background())
+	var degraded *DegradedError
+	require.ErrorAs(t, err, &degraded)
+	assert.Equal(t, report, degraded.Report)
+	assert.Equal(t, "degraded", report.Status)
+	assert.Zero(t, report.DatasetRows)
+}
+
+func TestHealthcheck_Decode(t *testing.T) {
+	loaded := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"degraded","dataset_rows":7,"dataset_loaded_at":"2024-05-01T12:00:00Z",` +
+			`"cache_hit_rate":0.25,"active_requests":3,"uptime":90000000000}`))
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+	report, err := sc.Healthcheck(context.Background())
+	var degraded *DegradedError
+	require.ErrorAs(t, err, &degraded)
+	assert.Equal(t, &HealthReport{
+		Status: "degraded", DatasetRows: 7, DatasetLoadedAt: loaded,
+		CacheHitRate: 0.25, ActiveRequests: 3, Uptime: 90 * time.Second,
+	}, report)
+	assert.Contains(t, err.Error(), "degraded")
+
+	ts.Close()
+	_, err = sc.Healthcheck(context.Background())
+	var netErr *NetworkError
+	assert.ErrorAs(t, err, &netErr)
+}
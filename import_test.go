@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// сколько может весить загружаемый файл
+const maxImportBytes = 10 << 20
+
+// ImportResult - ответ /admin/import
+type ImportResult struct {
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors"`
+}
+
+// importUsers принимает в поле file формы multipart/form-data XML в формате dataset.xml и дописывает строки к данным.
+// Строки с Id, который уже есть в данных или раньше в этом же файле, пропускаются и попадают в errors
+func (s *SearchServer) importUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	if err := r.ParseMultipartForm(maxImportBytes); err != nil {
+		if errors.Is(err, http.ErrNotMultipart) {
+			writeError(w, http.StatusUnsupportedMediaType, "expected multipart/form-data")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "cant parse form: "+err.Error())
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "missing file")
+		return
+	}
+	defer file.Close()
+	var upload DataSet
+	if err := xml.NewDecoder(file).Decode(&upload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid xml: "+err.Error())
+		return
+	}
+
+	res := ImportResult{Errors: []string{}}
+	var imported []Row
+	err = s.updateRows(func(rows []Row) ([]Row, error) {
+		seen := make(map[int]bool, len(rows)+len(upload.Rows))
+		for _, row := range rows {
+			seen[row.ID] = true
+		}
+		for i := range upload.Rows {
+			row := upload.Rows[i]
+			if seen[row.ID] {
+				res.Skipped++
+				res.Errors = append(res.Errors, fmt.Sprintf("row %d: duplicate id %d", i, row.ID))
+				continue
+			}
+			seen[row.ID] = true
+			rows = append(rows, row)
+			imported = append(imported, row)
+			res.Imported++
+		}
+		return rows, nil
+	}, func() {
+		for i := range imported {
+			s.recordChange("import", r, nil, &imported[i])
+		}
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "cant save imported users: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func uploadImport(t *testing.T, url, token string, file []byte) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "import.xml")
+	require.NoError(t, err)
+	part.Write(file)
+	require.NoError(t, mw.Close())
+
+	req, err := http.NewRequest(http.MethodPost, url+"/admin/import", &body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestAdminImport(t *testing.T) {
+	ts := NewTestServer(t, WithManagementToken("admin"))
+	fixture, err := os.ReadFile("testdata/import_partial.xml")
+	require.NoError(t, err)
+
+	resp := uploadImport(t, ts.URL, "admin", fixture)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var res ImportResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, 2, res.Imported)
+	assert.Equal(t, 2, res.Skipped)
+	assert.Equal(t, []string{"row 1: duplicate id 5", "row 3: duplicate id 100"}, res.Errors)
+
+	users, err := ts.SearchClient("test_token").FindUsers(SearchRequest{Limit: 10, Query: "Imported", OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	require.Len(t, users.Users, 2)
+	assert.Equal(t, User{Id: 100, Name: "Imported Walker", Age: 41, About: "Came in through the admin import.", Gender: "male"}, users.Users[0])
+	assert.Equal(t, 101, users.Users[1].Id)
+
+	// существующий пользователь не затёрт
+	users, err = ts.SearchClient("test_token").FindUsers(SearchRequest{Limit: 1, Query: "Clashing"})
+	require.NoError(t, err)
+	assert.Empty(t, users.Users)
+
+	// повторная загрузка того же файла ничего не добавляет
+	resp = uploadImport(t, ts.URL, "admin", fixture)
+	defer resp.Body.Close()
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, 0, res.Imported)
+	assert.Equal(t, 4, res.Skipped)
+}
+
+func TestAdminImport_Errors(t *testing.T) {
+	ts := NewTestServer(t, WithManagementToken("admin"))
+
+	resp := uploadImport(t, ts.URL, "wrong", []byte("<root/>"))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = uploadImport(t, ts.URL, "admin", []byte("<root><row>"))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/admin/import", bytes.NewReader([]byte("<root/>")))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Authorization", "Bearer admin")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	resp = adminRequest(t, http.MethodGet, ts.URL+"/admin/import", "admin")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// не сохранилось - не о чем и отчитываться
+	key := []byte("0123456789abcdef")
+	c, err := newAboutCipher(key)
+	require.NoError(t, err)
+	rows, err := c.encryptRows([]Row{{ID: 0, FirstName: "A"}})
+	require.NoError(t, err)
+	s := NewSearchServer(WithDataSet(DataSet{Rows: rows}), WithAboutEncryption(key), WithManagementToken("admin"))
+	s.aboutCipher.nonces = iotest.ErrReader(errors.New("no entropy"))
+	broken := httptest.NewServer(s)
+	defer broken.Close()
+	fixture, err := os.ReadFile("testdata/import_partial.xml")
+	require.NoError(t, err)
+	resp = uploadImport(t, broken.URL, "admin", fixture)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.NotContains(t, string(body), `"imported":`)
+	assert.Len(t, s.data().Rows, 1)
+	assert.Empty(t, s.changelog.list(-1, time.Time{}, 10))
+}
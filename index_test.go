@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// searchIndex - триграммный индекс по Name и About в нижнем регистре.
+// Строится по снимку данных и дальше не меняется: новые строки и правки текста в нём видны только
+// после перестройки. Сами строки индекс не хранит, только их Id, содержимое всегда берётся из текущих данных
+type searchIndex struct {
+	ids      []int
+	trigrams map[string][]int
+}
+
+func buildSearchIndex(rows []Row) *searchIndex {
+	ix := &searchIndex{ids: make([]int, 0, len(rows)), trigrams: map[string][]int{}}
+	for i, row := range rows {
+		ix.ids = append(ix.ids, row.ID)
+		text := strings.ToLower(row.FirstName + " " + row.LastName + "\x00" + row.About)
+		seen := map[string]bool{}
+		for j := 0; j+3 <= len(text); j++ {
+			tri := text[j : j+3]
+			if !seen[tri] {
+				seen[tri] = true
+				ix.trigrams[tri] = append(ix.trigrams[tri], i)
+			}
+		}
+	}
+	return ix
+}
+
+// candidates - Id строк, в которых есть все триграммы запроса.
+// Для OR-запросов и запросов короче трёх байт индекс не помогает, тогда used == false
+func (ix *searchIndex) candidates(f searchFilter) (ids map[int]bool, used bool) {
+	query := strings.ToLower(f.query)
+	if len(f.queries) > 0 || len(query) < 3 {
+		return nil, false
+	}
+	var positions []int
+	for j := 0; j+3 <= len(query); j++ {
+		postings := ix.trigrams[query[j:j+3]]
+		if j == 0 {
+			positions = postings
+			continue
+		}
+		positions = intersectSorted(positions, postings)
+		if len(positions) == 0 {
+			break
+		}
+	}
+	ids = make(map[int]bool, len(positions))
+	for _, p := range positions {
+		ids[ix.ids[p]] = true
+	}
+	return ids, true
+}
+
+// pick оставляет из rows те, чьи Id есть в ids, порядок сохраняется
+func pick(rows []Row, ids map[int]bool) []Row {
+	out := make([]Row, 0, len(ids))
+	for _, row := range rows {
+		if ids[row.ID] {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+func intersectSorted(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// WithSearchIndex включает поиск по индексу, построенному по данным на момент создания сервера
+func WithSearchIndex() ServerOption {
+	return func(s *SearchServer) {
+		s.indexed = true
+	}
+}
+
+// searchRows - строки, по которым дальше работает фильтр, и использовался ли индекс.
+// Строки всегда из текущих данных, индекс только сужает их набор
+func (s *SearchServer) searchRows(f searchFilter) ([]Row, bool) {
+	rows := s.data().Rows
+	ix := s.index.Load()
+	if ix == nil {
+		return rows, false
+	}
+	ids, used := ix.candidates(f)
+	if !used {
+		return rows, false
+	}
+	return pick(rows, ids), true
+}
+
+func TestSearchIndex_MatchesFullScan(t *testing.T) {
+	ix := buildSearchIndex(dataset.Rows)
+	for _, q := range []string{"Boyd", "boyd wolf", "olf", "nulla", "sit amet", "zzz", "Bo", ""} {
+		f := searchFilter{query: q}
+		found, used := ix.candidates(f)
+		assert.Equal(t, len(q) >= 3, used, q)
+		rows := dataset.Rows
+		if used {
+			rows = pick(rows, found)
+		}
+
+		want := ids(f.apply(dataset.Rows))
+		got := ids(f.apply(rows))
+		assert.Equal(t, want, got, q)
+	}
+}
+
+func ids(users []User) []int {
+	out := []int{}
+	for _, u := range users {
+		out = append(out, u.Id)
+	}
+	sort.Ints(out)
+	return out
+}
+
+func TestSearchIndex_DebugReportsIndex(t *testing.T) {
+	ts := NewTestServer(t, WithSearchIndex())
+	resp, err := ts.SearchClient("test_token").FindUsers(SearchRequest{Limit: 1, Query: "Boyd", Debug: true})
+	require.NoError(t, err)
+	assert.Equal(t, true, resp.Debug["index_used"])
+	assert.Less(t, resp.Debug["rows_scanned"], float64(len(dataset.Rows)))
+
+	resp, err = ts.SearchClient("test_token").FindUsers(SearchRequest{Limit: 1, Query: "Bo", Debug: true})
+	require.NoError(t, err)
+	assert.Equal(t, false, resp.Debug["index_used"])
+
+	count, err := http.Get(ts.URL + "/search/count?query=Boyd")
+	require.NoError(t, err)
+	count.Body.Close()
+	assert.Equal(t, http.StatusOK, count.StatusCode)
+}
+
+func TestSearchIndex_SeesMutations(t *testing.T) {
+	ts := NewTestServer(t, WithSearchIndex())
+	sc := ts.SearchClient("test_token")
+	find := func(q string) map[int]User {
+		t.Helper()
+		resp, err := sc.FindUsers(SearchRequest{Limit: 25, Query: q, Debug: true})
+		require.NoError(t, err)
+		assert.Equal(t, len(q) >= 3, resp.Debug["index_used"], q)
+		found := map[int]User{}
+		for _, u := range resp.Users {
+			found[u.Id] = u
+		}
+		return found
+	}
+	require.Contains(t, find("Boyd"), 0)
+
+	resp, _ := userRequest(t, http.MethodGet, ts.URL+"/users/1", "", "")
+	resp, _ = userRequest(t, http.MethodPatch, ts.URL+"/users/1", resp.Header.Get("ETag"), `{"Age": 99}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = userRequest(t, http.MethodDelete, ts.URL+"/users/0", "", "")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	for _, q := range []string{"Boyd", "Bo"} {
+		assert.NotContains(t, find(q), 0, "deleted user is hidden, query %q", q)
+	}
+	name := strings.ToLower(dataset.Rows[1].FirstName)
+	assert.Equal(t, 99, find(name)[1].Age, "index returns current row contents")
+}
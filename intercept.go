@@ -0,0 +1,32 @@
+package main
+
+import "context"
+
+// InterceptFunc правит ответ поиска перед тем, как его получит вызывающий, ошибка прерывает поиск
+type InterceptFunc func(ctx context.Context, req SearchRequest, resp *SearchResponse) error
+
+// Intercept добавляет fn к обработчикам ответов FindUsers/Do, например чтобы скрыть часть пользователей.
+// Обработчики вызываются по порядку добавления в той же горутине, что и поиск. Первая же ошибка
+// прерывает цепочку и возвращается из поиска вместо ответа. req - запрос в том виде, в каком его передали
+func (srv *SearchClient) Intercept(fn InterceptFunc) {
+	srv.mu.Lock()
+	srv.interceptors = append(srv.interceptors, fn)
+	srv.mu.Unlock()
+}
+
+func (srv *SearchClient) intercept(ctx context.Context, req SearchRequest, resp *SearchResponse) (*SearchResponse, error) {
+	srv.mu.RLock()
+	interceptors := srv.interceptors
+	srv.mu.RUnlock()
+	if len(interceptors) == 0 {
+		return resp, nil
+	}
+	// пользователи ответа могут делить массив с кешем ETag, а обработчики вольны их менять
+	resp = resp.clone()
+	for _, fn := range interceptors {
+		if err := fn(ctx, req, resp); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
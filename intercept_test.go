@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntercept(t *testing.T) {
+	ts := NewTestServer(t, WithSearchETags(true))
+	sc, err := NewSearchClient(ts.URL, "test_token", WithETagCache())
+	require.NoError(t, err)
+	req := SearchRequest{Limit: 25, OrderField: "Id", OrderBy: OrderByAsc}
+
+	all, err := ts.SearchClient("test_token").FindUsers(req)
+	require.NoError(t, err)
+	over30 := 0
+	for _, u := range all.Users {
+		if u.Age > 30 {
+			over30++
+		}
+	}
+	require.NotZero(t, over30)
+
+	var calls []string
+	sc.Intercept(func(ctx context.Context, got SearchRequest, resp *SearchResponse) error {
+		calls = append(calls, "redact")
+		assert.Equal(t, req, got)
+		kept := resp.Users[:0]
+		for _, u := range resp.Users {
+			if u.Age <= 30 {
+				kept = append(kept, u)
+			}
+		}
+		resp.Users = kept
+		return nil
+	})
+	sc.Intercept(func(ctx context.Context, _ SearchRequest, resp *SearchResponse) error {
+		calls = append(calls, "check")
+		for _, u := range resp.Users {
+			assert.LessOrEqual(t, u.Age, 30, "interceptors run in order")
+		}
+		return nil
+	})
+
+	redacted, err := sc.FindUsers(req)
+	require.NoError(t, err)
+	assert.Len(t, redacted.Users, len(all.Users)-over30)
+	assert.Equal(t, []string{"redact", "check"}, calls)
+	assert.Equal(t, redacted, sc.GetLastResponse())
+
+	// второй раз ответ берётся из кеша ETag, правка в обработчике не должна была его испортить
+	again, err := sc.FindUsers(req)
+	require.NoError(t, err)
+	assert.Equal(t, redacted.Users, again.Users)
+
+	errDenied := errors.New("denied")
+	calls = nil
+	sc.Intercept(func(context.Context, SearchRequest, *SearchResponse) error { return errDenied })
+	sc.Intercept(func(context.Context, SearchRequest, *SearchResponse) error {
+		calls = append(calls, "never")
+		return nil
+	})
+	resp, err := sc.FindUsers(req)
+	assert.ErrorIs(t, err, errDenied)
+	assert.Nil(t, resp)
+	assert.Equal(t, []string{"redact", "check"}, calls, "error aborts the chain")
+	assert.Equal(t, redacted, sc.GetLastResponse(), "failed search does not replace the last response")
+}
+
+func TestIntercept_StreamWithoutLimit(t *testing.T) {
+	ts := NewTestServer(t, WithNoLimitAllowed(true))
+	store := InMemoryRequestStore(10)
+	sc, err := NewSearchClient(ts.URL, "test_token", WithRequestRecorder(store))
+	require.NoError(t, err)
+	var seen []SearchRequest
+	sc.Intercept(func(_ context.Context, req SearchRequest, resp *SearchResponse) error {
+		seen = append(seen, req)
+		resp.Users = resp.Users[:1]
+		return nil
+	})
+
+	ix, err := sc.BulkSearchAndIndex(context.Background(), []SearchRequest{{Query: "nulla"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, ix.Len(), "index is built from the intercepted response")
+	require.Len(t, seen, 1)
+	assert.Equal(t, -1, seen[0].Limit)
+	entries := store.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, -1, entries[0].Request.Limit)
+}
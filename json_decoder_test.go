@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithJSONDecoder(t *testing.T) {
+	ts := NewTestServer(t)
+	var calls atomic.Int32
+	sc, err := NewSearchClient(ts.URL, "test_token", WithJSONDecoder(func(data []byte, v interface{}) error {
+		calls.Add(1)
+		return jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, v)
+	}))
+	require.NoError(t, err)
+	std := ts.SearchClient("test_token")
+
+	for i, req := range []SearchRequest{
+		{Limit: 5},
+		{Limit: 25, Query: "nulla", OrderField: "Age", OrderBy: OrderByDesc},
+		{Limit: 5, Query: "nobody-has-this-name"},
+	} {
+		got, err := sc.FindUsers(req)
+		require.NoError(t, err)
+		assert.Equal(t, int32(i+1), calls.Load(), "exactly one decode per FindUsers")
+		want, err := std.FindUsers(req)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// ответ с ошибкой разбирает encoding/json
+	_, err = sc.FindUsers(SearchRequest{Limit: 5, OrderField: "Unknown"})
+	require.Error(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+
+	_, err = NewSearchClient(ts.URL, "test_token", WithJSONDecoder(nil))
+	assert.Error(t, err)
+}
+
+// BenchmarkJSONDecoder сравнивает разбор полной выдачи. User реализует UnmarshalJSON через encoding/json,
+// а совместимый режим jsoniter такие методы уважает, так что выигрыша от него здесь ждать не стоит
+func BenchmarkJSONDecoder(b *testing.B) {
+	users := make([]User, 0, len(dataset.Rows))
+	for _, row := range dataset.Rows {
+		users = append(users, rowToUser(row))
+	}
+	body, err := json.Marshal(users)
+	require.NoError(b, err)
+
+	for _, bc := range []struct {
+		name string
+		dec  func(data []byte, v interface{}) error
+	}{
+		{"encoding/json", json.Unmarshal},
+		{"json-iterator", jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			srv := &SearchClient{jsonDecoder: bc.dec}
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var out []User
+				if err := srv.decodeJSON(body, &out); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
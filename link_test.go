@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// searchLinks собирает Link (RFC 5988) с first и, если есть следующая страница, next.
+// Ссылки абсолютные, от схемы и хоста входящего запроса, остальные параметры сохраняются.
+// Без limit страниц нет, тогда пустая строка
+func searchLinks(r *http.Request, page searchPage, total int) string {
+	if page.noLimit {
+		return ""
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	link := func(offset int, rel string) string {
+		params := url.Values{}
+		for k, v := range r.Form {
+			params[k] = v
+		}
+		params.Set("offset", strconv.Itoa(offset))
+		u := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: params.Encode()}
+		return "<" + u.String() + `>; rel="` + rel + `"`
+	}
+
+	links := []string{}
+	if next := page.offset + page.limit; next < total {
+		links = append(links, link(next, "next"))
+	}
+	links = append(links, link(0, "first"))
+	return strings.Join(links, ", ")
+}
+
+var linkRe = regexp.MustCompile(`<([^>]*)>;\s*rel="([^"]*)"`)
+
+// parseLinks разбирает Link в rel -> url
+func parseLinks(t *testing.T, header string) map[string]*url.URL {
+	t.Helper()
+	links := map[string]*url.URL{}
+	for _, m := range linkRe.FindAllStringSubmatch(header, -1) {
+		u, err := url.Parse(m[1])
+		require.NoError(t, err)
+		links[m[2]] = u
+	}
+	return links
+}
+
+func TestSearch_LinkHeader(t *testing.T) {
+	ts := NewTestServer(t)
+	get := func(offset int) map[string]*url.URL {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/search?limit=10&order_by=1&order_field=Id&query=&offset=" + strconv.Itoa(offset))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return parseLinks(t, resp.Header.Get("Link"))
+	}
+
+	links := get(0)
+	require.Contains(t, links, "next")
+	require.Contains(t, links, "first")
+	next := links["next"]
+	assert.Equal(t, "http", next.Scheme)
+	assert.Equal(t, strings.TrimPrefix(ts.URL, "http://"), next.Host)
+	assert.Equal(t, "/search", next.Path)
+	assert.Equal(t, "10", next.Query().Get("offset"))
+	assert.Equal(t, "10", next.Query().Get("limit"))
+	assert.Equal(t, "Id", next.Query().Get("order_field"))
+	assert.Equal(t, "0", links["first"].Query().Get("offset"))
+
+	links = get(20)
+	assert.Equal(t, "30", links["next"].Query().Get("offset"))
+
+	// последняя страница: 30..34
+	links = get(30)
+	assert.NotContains(t, links, "next")
+	assert.Contains(t, links, "first")
+}
+
+func TestSearch_LinkHeader_NoLimit(t *testing.T) {
+	ts := NewTestServer(t, WithNoLimitAllowed(true))
+	resp, err := http.Get(ts.URL + "/search?limit=-1&offset=0&order_by=0")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, resp.Header.Get("Link"))
+}
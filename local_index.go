@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// OrderField - поле, по которому сортирует LocalIndex, значения те же, что у SearchRequest.OrderField
+type OrderField string
+
+const (
+	OrderFieldID   OrderField = "Id"
+	OrderFieldAge  OrderField = "Age"
+	OrderFieldName OrderField = "Name"
+)
+
+// DatasetStats - сводка по пользователям в LocalIndex
+type DatasetStats struct {
+	Users   int
+	MinAge  int
+	MaxAge  int
+	MeanAge float64
+	Genders map[string]int
+}
+
+// LocalIndex - пользователи, собранные с сервера, для поиска без сети. Не меняется после создания
+type LocalIndex struct {
+	users map[int]User
+}
+
+// BulkSearchAndIndex выполняет все запросы через StreamUsers (Limit - общее ограничение, 0 - всё)
+// и складывает найденных пользователей в LocalIndex без повторов по Id
+func (srv *SearchClient) BulkSearchAndIndex(ctx context.Context, queries []SearchRequest) (*LocalIndex, error) {
+	ix := &LocalIndex{users: map[int]User{}}
+	for _, q := range queries {
+		err := srv.StreamUsers(ctx, q, func(u User) error {
+			ix.users[u.Id] = u
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ix, nil
+}
+
+// Len - сколько пользователей в индексе
+func (ix *LocalIndex) Len() int {
+	return len(ix.users)
+}
+
+// Search ищет подстроку в Name и About без учёта регистра, как сервер. Результат отсортирован по Id
+func (ix *LocalIndex) Search(q string) []User {
+	q = strings.ToLower(q)
+	var found []User
+	for _, u := range ix.users {
+		if strings.Contains(strings.ToLower(u.Name), q) || strings.Contains(strings.ToLower(u.About), q) {
+			found = append(found, u)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Id < found[j].Id })
+	return found
+}
+
+// SortBy возвращает всех пользователей, отсортированных по field в направлении dir (OrderByAsc, OrderByDesc).
+// При равенстве и при OrderByAsIs - по возрастанию Id
+func (ix *LocalIndex) SortBy(field OrderField, dir int) []User {
+	users := ix.Search("")
+	if dir == OrderByAsIs {
+		return users
+	}
+	less := func(a, b User) bool {
+		switch field {
+		case OrderFieldAge:
+			return a.Age < b.Age
+		case OrderFieldName:
+			return a.Name < b.Name
+		}
+		return a.Id < b.Id
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		if dir == OrderByDesc {
+			return less(users[j], users[i])
+		}
+		return less(users[i], users[j])
+	})
+	return users
+}
+
+// Stats считает сводку по всем пользователям индекса
+func (ix *LocalIndex) Stats() DatasetStats {
+	st := DatasetStats{Users: len(ix.users), Genders: map[string]int{}}
+	total := 0
+	first := true
+	for _, u := range ix.users {
+		if first || u.Age < st.MinAge {
+			st.MinAge = u.Age
+		}
+		if first || u.Age > st.MaxAge {
+			st.MaxAge = u.Age
+		}
+		first = false
+		total += u.Age
+		st.Genders[u.Gender]++
+	}
+	if st.Users > 0 {
+		st.MeanAge = float64(total) / float64(st.Users)
+	}
+	return st
+}
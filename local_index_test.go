@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkSearchAndIndex(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	ix, err := sc.BulkSearchAndIndex(context.Background(), []SearchRequest{
+		{Limit: 30, Query: "nulla"},
+		{Limit: 30, Query: "Boyd"},
+		{Limit: 30, Query: "nulla"},
+	})
+	require.NoError(t, err)
+
+	want := map[int]bool{}
+	for _, q := range []string{"nulla", "Boyd"} {
+		resp, err := sc.FindUsers(SearchRequest{Limit: 25, Query: q})
+		require.NoError(t, err)
+		require.False(t, resp.NextPage)
+		for _, u := range resp.Users {
+			want[u.Id] = true
+		}
+	}
+	assert.Equal(t, len(want), ix.Len())
+
+	boyd := ix.Search("boyd")
+	require.Len(t, boyd, 1)
+	assert.Equal(t, "Boyd Wolf", boyd[0].Name)
+	assert.Len(t, ix.Search(""), ix.Len())
+
+	byAge := ix.SortBy(OrderFieldAge, OrderByAsc)
+	for i := 1; i < len(byAge); i++ {
+		assert.LessOrEqual(t, byAge[i-1].Age, byAge[i].Age)
+	}
+	byID := ix.SortBy(OrderFieldID, OrderByDesc)
+	for i := 1; i < len(byID); i++ {
+		assert.Greater(t, byID[i-1].Id, byID[i].Id)
+	}
+
+	st := ix.Stats()
+	assert.Equal(t, ix.Len(), st.Users)
+	assert.Equal(t, byAge[0].Age, st.MinAge)
+	assert.Equal(t, byAge[len(byAge)-1].Age, st.MaxAge)
+	assert.True(t, float64(st.MinAge) <= st.MeanAge && st.MeanAge <= float64(st.MaxAge))
+	assert.Equal(t, ix.Len(), st.Genders["male"]+st.Genders["female"])
+
+	_, err = sc.BulkSearchAndIndex(context.Background(), []SearchRequest{{Limit: 1, OrderField: "About"}})
+	require.Error(t, err)
+}
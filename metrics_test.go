@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush и Push пробрасываются, иначе за метриками молча пропали бы WithStreaming и WithHTTP2Push
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Push(target string, opts *http.PushOptions) error {
+	if p, ok := r.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap - для http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// endpointLabel сводит путь к шаблону роута, чтобы /users/1, /users/2... не плодили отдельные метки
+func endpointLabel(path string) string {
+	switch {
+	case path == "/" || path == "/search":
+		return "/search"
+	case strings.HasPrefix(path, "/users/"):
+		return "/users/{id}"
+	case path == "/healthz":
+		return "/healthz"
+	case path == "/stats" || strings.HasPrefix(path, "/stats/"):
+		return "/stats"
+	}
+	return "other"
+}
+
+// ServeWithMetrics возвращает обработчик сервера, обёрнутый в MetricsMiddleware
+func (s *SearchServer) ServeWithMetrics(reg prometheus.Registerer) (http.Handler, error) {
+	mw, err := MetricsMiddleware(reg)
+	if err != nil {
+		return nil, err
+	}
+	return mw(s), nil
+}
+
+// MetricsMiddleware регистрирует в reg счётчик запросов и гистограмму времени ответа
+// и обновляет их на каждый запрос
+func MetricsMiddleware(reg prometheus.Registerer) (Middleware, error) {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by endpoint, method and status.",
+	}, []string{"endpoint", "method", "status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by endpoint and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "method"})
+	if err := reg.Register(requests); err != nil {
+		return nil, err
+	}
+	if err := reg.Register(duration); err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			endpoint := endpointLabel(r.URL.Path)
+			requests.WithLabelValues(endpoint, r.Method, strconv.Itoa(rec.status)).Inc()
+			duration.WithLabelValues(endpoint, r.Method).Observe(time.Since(start).Seconds())
+		})
+	}, nil
+}
+
+func TestServeWithMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h, err := NewSearchServer().ServeWithMetrics(reg)
+	require.NoError(t, err)
+
+	ts := NewTestServer(t)
+	ts.Config.Handler = h
+
+	for _, path := range []string{
+		"/search?limit=1&offset=0&order_by=0",
+		"/search?limit=1&offset=0&order_by=0",
+		"/search?limit=x",
+		"/stats/fields/age",
+		"/users/1",
+		"/users/2",
+		"/healthz",
+	} {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	counters := map[string]float64{}
+	observations := map[string]uint64{}
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			switch mf.GetName() {
+			case "http_requests_total":
+				counters[labels["endpoint"]+" "+labels["status"]] += m.GetCounter().GetValue()
+			case "http_request_duration_seconds":
+				observations[labels["endpoint"]] += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"/search 200":     2,
+		"/search 400":     1,
+		"/stats 200":      1,
+		"/users/{id} 200": 2,
+		"/healthz 200":    1,
+	}, counters)
+	assert.Equal(t, map[string]uint64{"/search": 3, "/stats": 1, "/users/{id}": 2, "/healthz": 1}, observations)
+
+	_, err = NewSearchServer().ServeWithMetrics(reg)
+	assert.Error(t, err)
+}
+
+func TestServeWithMetrics_StreamingAndPush(t *testing.T) {
+	h, err := NewSearchServer(WithStreaming(true), WithHTTP2Push(true)).ServeWithMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?limit=2&offset=0&order_by=1&order_field=Id", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, rec.Flushed, "streaming flushes through the metrics wrapper")
+	assert.Len(t, rec.pushed, 1, "push goes through the metrics wrapper")
+}
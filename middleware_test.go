@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Middleware оборачивает обработчик, добавляя что-то до или после него
+type Middleware func(http.Handler) http.Handler
+
+// Chain собирает middlewares в одну, первая в списке оборачивает все остальные и видит запрос первой
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// bearerAuth пускает дальше только запросы с Authorization: Bearer <token>
+func bearerAuth(token string) Middleware {
+	want := []byte("Bearer " + token)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// searchParams - всё, что понимает поиск, остальное он молча игнорирует
+var searchParams = []string{
+	"limit", "offset", "query", "queries", "not_query", "gender",
+	"include_deleted", "debug", "order_field", "order_by",
+	"since_id", "min_score", "random_sample", "seed", "order_criteria",
+	"after_id", "before_id",
+}
+
+// UnknownParamWarning добавляет по заголовку X-Deprecation-Warning на каждый параметр запроса не из known,
+// чтобы клиенты со старыми именами вроде sort_field узнали, что их не слушают
+func UnknownParamWarning(known ...string) Middleware {
+	allowed := make(map[string]bool, len(known))
+	for _, k := range known {
+		allowed[k] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var unknown []string
+			for name := range r.URL.Query() {
+				if !allowed[name] {
+					unknown = append(unknown, name)
+				}
+			}
+			sort.Strings(unknown)
+			for _, name := range unknown {
+				w.Header().Add("X-Deprecation-Warning", fmt.Sprintf("unknown parameter %q", name))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Add("X-Trace", name)
+				w.Header().Add("X-Trace", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	var seen []string
+	h := Chain(mark("a"), mark("b"), mark("c"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Values("X-Trace")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, []string{"a", "b", "c"}, seen)
+	assert.Equal(t, []string{"a", "b", "c"}, rec.Header().Values("X-Trace"))
+
+	rec = httptest.NewRecorder()
+	Chain()(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestBearerAuth(t *testing.T) {
+	h := bearerAuth("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for auth, want := range map[string]int{"": 401, "Bearer nope": 401, "secret": 401, "Bearer secret": 200} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Code, auth)
+	}
+}
+
+func TestUnknownParamWarning(t *testing.T) {
+	ts := NewTestServer(t)
+	warnings := func(path string) []string {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header.Values("X-Deprecation-Warning")
+	}
+
+	assert.Empty(t, warnings("/search?limit=1&offset=0&order_field=Id&order_by=1&query=a"))
+	assert.Equal(t, []string{`unknown parameter "sort_field"`},
+		warnings("/search?limit=1&offset=0&order_by=0&sort_field=Id"))
+	assert.Equal(t, []string{`unknown parameter "page"`, `unknown parameter "sort_field"`},
+		warnings("/?sort_field=Id&limit=1&offset=0&order_by=0&page=2"))
+}
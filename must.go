@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Must*-варианты паникуют вместо возврата ошибки. Они только для тестов и init(),
+// где ошибка всё равно означает, что дальше продолжать нельзя. В рабочем коде ими не пользоваться
+
+// MustFindUsers - Do без mutate, паникует с описанием запроса, если поиск не удался
+func (srv *SearchClient) MustFindUsers(ctx context.Context, req SearchRequest) *SearchResponse {
+	resp, err := srv.Do(ctx, req, nil)
+	if err != nil {
+		panic(fmt.Errorf("MustFindUsers(%s) on %s: %w", req.values().Encode(), srv.baseURL(), err))
+	}
+	return resp
+}
+
+// MustFindUserByID - FindUserByID без удалённых, паникует в том числе если пользователя нет
+func (srv *SearchClient) MustFindUserByID(ctx context.Context, id int) *User {
+	user, err := srv.FindUserByID(ctx, id, false)
+	if err != nil {
+		panic(fmt.Errorf("MustFindUserByID(%d) on %s: %w", id, srv.baseURL(), err))
+	}
+	return user
+}
+
+// MustCountUsers - CountUsers, паникующий при ошибке
+func (srv *SearchClient) MustCountUsers(ctx context.Context, req SearchRequest) int {
+	count, err := srv.CountUsers(ctx, req)
+	if err != nil {
+		panic(fmt.Errorf("MustCountUsers(%s) on %s: %w", req.values().Encode(), srv.baseURL(), err))
+	}
+	return count
+}
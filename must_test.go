@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recoverPanic возвращает то, с чем паникует fn
+func recoverPanic(t *testing.T, fn func()) (v interface{}) {
+	t.Helper()
+	require.Panics(t, fn)
+	defer func() { v = recover() }()
+	fn()
+	return nil
+}
+
+func TestMustHelpers(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+	ctx := context.Background()
+
+	resp := sc.MustFindUsers(ctx, SearchRequest{Limit: 5, Query: "Boyd"})
+	require.Len(t, resp.Users, 1)
+	assert.Equal(t, resp.Users[0], *sc.MustFindUserByID(ctx, resp.Users[0].Id))
+	assert.Equal(t, len(dataset.Rows), sc.MustCountUsers(ctx, SearchRequest{}))
+	assert.Equal(t, 1, sc.MustCountUsers(ctx, SearchRequest{Query: "Boyd", Limit: 5, Offset: 3}))
+
+	// никто не слушает - паника говорит, что и куда не удалось отправить
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	bad := &SearchClient{AccessToken: "test_token", URL: down.URL}
+
+	err, ok := recoverPanic(t, func() { bad.MustFindUsers(ctx, SearchRequest{Limit: 1, Query: "Boyd"}) }).(error)
+	require.True(t, ok, "panic value must be an error")
+	assert.Contains(t, err.Error(), "MustFindUsers(")
+	assert.Contains(t, err.Error(), "query=Boyd")
+	assert.Contains(t, err.Error(), down.URL)
+	assert.Contains(t, err.Error(), "connection refused")
+
+	err = recoverPanic(t, func() { bad.MustCountUsers(ctx, SearchRequest{}) }).(error)
+	assert.Contains(t, err.Error(), "MustCountUsers(")
+	err = recoverPanic(t, func() { sc.MustFindUserByID(ctx, 999) }).(error)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.Contains(t, err.Error(), "MustFindUserByID(999)")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+var placeholderRe = regexp.MustCompile(`\{\{(\w+)\}\}`)
+
+// NamedQuery - сохранённый шаблон поиска, в Template.Query можно писать {{param}}
+type NamedQuery struct {
+	Name       string
+	Template   SearchRequest
+	ParamNames []string
+}
+
+// Bind подставляет params в Template.Query. Значения вставляются как есть за один проход,
+// так что {{...}} внутри значения не раскрывается, а спецсимволы ничего не значат - сервер ищет просто подстроку
+func (q NamedQuery) Bind(params map[string]string) (SearchRequest, error) {
+	declared := make(map[string]bool, len(q.ParamNames))
+	for _, name := range q.ParamNames {
+		declared[name] = true
+		if _, ok := params[name]; !ok {
+			return SearchRequest{}, fmt.Errorf("query %s: missing param %q", q.Name, name)
+		}
+	}
+
+	var bindErr error
+	req := q.Template
+	req.Queries = append([]string(nil), q.Template.Queries...)
+	req.Query = placeholderRe.ReplaceAllStringFunc(q.Template.Query, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		if !declared[name] && bindErr == nil {
+			bindErr = fmt.Errorf("query %s: undeclared param %q", q.Name, name)
+		}
+		return params[name]
+	})
+	if bindErr != nil {
+		return SearchRequest{}, bindErr
+	}
+	return req, nil
+}
+
+var ErrNamedQueryExists = errors.New("named query already registered")
+
+// QueryRegistry хранит именованные запросы, безопасен для конкурентного использования
+type QueryRegistry struct {
+	mu      sync.RWMutex
+	queries map[string]NamedQuery
+}
+
+func NewQueryRegistry() *QueryRegistry {
+	return &QueryRegistry{queries: map[string]NamedQuery{}}
+}
+
+// Register добавляет запрос, имя должно быть непустым и ещё не занятым
+func (r *QueryRegistry) Register(q NamedQuery) error {
+	if q.Name == "" {
+		return errors.New("named query without name")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.queries[q.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrNamedQueryExists, q.Name)
+	}
+	r.queries[q.Name] = q
+	return nil
+}
+
+func (r *QueryRegistry) Get(name string) (NamedQuery, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	q, ok := r.queries[name]
+	return q, ok
+}
+
+func (r *QueryRegistry) Delete(name string) {
+	r.mu.Lock()
+	delete(r.queries, name)
+	r.mu.Unlock()
+}
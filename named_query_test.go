@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamedQuery_Bind(t *testing.T) {
+	q := NamedQuery{
+		Name:       "women-by-word",
+		Template:   SearchRequest{Limit: 10, Query: "{{first}} {{last}}", Gender: GenderFemale, Queries: []string{"x"}},
+		ParamNames: []string{"first", "last"},
+	}
+
+	req, err := q.Bind(map[string]string{"first": "Boyd", "last": "Wolf", "extra": "ignored"})
+	require.NoError(t, err)
+	assert.Equal(t, SearchRequest{Limit: 10, Query: "Boyd Wolf", Gender: GenderFemale, Queries: []string{"x"}}, req)
+	assert.Equal(t, "{{first}} {{last}}", q.Template.Query, "template is not modified")
+
+	_, err = q.Bind(map[string]string{"first": "Boyd"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"last"`)
+
+	// значения не раскрываются повторно и не трактуются как шаблон или регулярка
+	req, err = q.Bind(map[string]string{"first": "{{last}}", "last": `.*' OR 1=1; --$1`})
+	require.NoError(t, err)
+	assert.Equal(t, `{{last}} .*' OR 1=1; --$1`, req.Query)
+
+	_, err = NamedQuery{Name: "bad", Template: SearchRequest{Query: "{{nope}}"}}.Bind(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "undeclared")
+}
+
+func TestQueryRegistry(t *testing.T) {
+	r := NewQueryRegistry()
+	q := NamedQuery{Name: "young", Template: SearchRequest{Limit: 5, Query: "{{q}}"}, ParamNames: []string{"q"}}
+	require.NoError(t, r.Register(q))
+	assert.ErrorIs(t, r.Register(q), ErrNamedQueryExists)
+	require.Error(t, r.Register(NamedQuery{}))
+
+	got, ok := r.Get("young")
+	require.True(t, ok)
+	assert.Equal(t, q, got)
+
+	r.Delete("young")
+	_, ok = r.Get("young")
+	assert.False(t, ok)
+	require.NoError(t, r.Register(q))
+}
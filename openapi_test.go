@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routeDoc - описание ручки для /openapi.json, задаётся при регистрации через handle
+type routeDoc struct {
+	// путь в спецификации, если отличается от шаблона mux, например /users/{id} для /users/
+	Path    string
+	Summary string
+	Methods []string
+	// параметры запроса в урле
+	Params []ParamDoc
+	// принимает параметры поиска, они берутся из searchParamDocs в момент генерации, с текущими настройками
+	SearchParams bool
+	// то же, но только параметры фильтра, без пагинации и сортировки
+	FilterParams bool
+	// образцы тела запроса и ответа, схемы строятся по их типам через reflect
+	Request  interface{}
+	Response interface{}
+	// ответ не JSON, а другого типа, например application/xml
+	ContentType string
+	// нужен Authorization: Bearer <management token>
+	Auth bool
+}
+
+// handle регистрирует обработчик и запоминает его описание для GenerateOpenAPISpec
+func (s *SearchServer) handle(pattern string, h http.Handler, doc routeDoc) {
+	if doc.Path == "" {
+		doc.Path = pattern
+	}
+	s.mux.Handle(pattern, h)
+	s.routes = append(s.routes, doc)
+}
+
+// filterParams - параметры поиска, которые влияют на то, кто попадает в выдачу, а не на её порядок и размер
+var filterParams = map[string]bool{
+	"query": true, "queries": true, "not_query": true, "gender": true, "include_deleted": true, "since_id": true,
+	"after_id": true, "before_id": true,
+}
+
+var pathParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// GenerateOpenAPISpec собирает спецификацию OpenAPI 3.0 по ручкам, зарегистрированным через handle.
+// Комментарии к коду в рантайме недоступны, поэтому описания берутся из routeDoc
+func (s *SearchServer) GenerateOpenAPISpec() ([]byte, error) {
+	paths := map[string]interface{}{}
+	for _, route := range s.routes {
+		var params []interface{}
+		for _, name := range pathParamRe.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": name[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		docs := route.Params
+		switch {
+		case route.SearchParams:
+			docs = append(s.searchParamDocs(), docs...)
+		case route.FilterParams:
+			for _, p := range s.searchParamDocs() {
+				if filterParams[p.Name] {
+					docs = append(docs, p)
+				}
+			}
+		}
+		for _, p := range docs {
+			params = append(params, paramSpec(p))
+		}
+
+		ops := map[string]interface{}{}
+		for _, method := range route.Methods {
+			op := map[string]interface{}{
+				"summary":   route.Summary,
+				"responses": responsesSpec(route),
+			}
+			if len(params) > 0 {
+				op["parameters"] = params
+			}
+			if route.Request != nil && method != http.MethodGet && method != http.MethodDelete {
+				op["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(route.Request))}},
+				}
+			}
+			if route.Auth {
+				op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+			}
+			ops[strings.ToLower(method)] = op
+		}
+		paths[route.Path] = ops
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": "SearchServer", "version": "1.0.0"},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}, "", "  ")
+}
+
+func responsesSpec(route routeDoc) map[string]interface{} {
+	ok := map[string]interface{}{"description": "OK"}
+	switch {
+	case route.ContentType != "":
+		ok["content"] = map[string]interface{}{route.ContentType: map[string]interface{}{}}
+	case route.Response != nil:
+		ok["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(route.Response))}}
+	}
+	errorBody := map[string]interface{}{"schema": map[string]interface{}{
+		"type": "object", "properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+	}}
+	responses := map[string]interface{}{
+		"200": ok,
+		"400": map[string]interface{}{"description": "Bad request", "content": map[string]interface{}{"application/json": errorBody}},
+	}
+	if route.Auth {
+		responses["401"] = map[string]interface{}{"description": "Missing or wrong management token"}
+	}
+	return responses
+}
+
+func paramSpec(p ParamDoc) map[string]interface{} {
+	schema := map[string]interface{}{}
+	switch p.Type {
+	case "int":
+		schema["type"] = "integer"
+	case "int64":
+		schema["type"], schema["format"] = "integer", "int64"
+	case "float":
+		schema["type"] = "number"
+	case "bool":
+		schema["type"] = "boolean"
+	case "[]string":
+		schema["type"], schema["items"] = "array", map[string]interface{}{"type": "string"}
+	default:
+		schema["type"] = "string"
+	}
+	if p.Minimum != nil {
+		schema["minimum"] = *p.Minimum
+	}
+	if p.Enum != nil {
+		schema["enum"] = p.Enum
+	}
+	if p.Default != "" {
+		schema["default"] = p.Default
+	}
+	spec := map[string]interface{}{"name": p.Name, "in": "query", "required": p.Required, "schema": schema}
+	if p.Constraints != "" {
+		spec["description"] = p.Constraints
+	}
+	if p.Example != nil {
+		spec["example"] = p.Example
+	}
+	return spec
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf строит JSON-схему по типу так же, как его кодирует encoding/json
+func schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = schemaOf(f.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+	return map[string]interface{}{}
+}
+
+func (s *SearchServer) openAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	spec, err := s.GenerateOpenAPISpec()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "cant build spec")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	ts := NewTestServer(t, WithManagementToken("admin"))
+	resp, err := http.Get(ts.URL + "/openapi.json")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			Summary    string `json:"summary"`
+			Parameters []struct {
+				Name     string                 `json:"name"`
+				In       string                 `json:"in"`
+				Required bool                   `json:"required"`
+				Schema   map[string]interface{} `json:"schema"`
+				Example  interface{}            `json:"example"`
+			} `json:"parameters"`
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema map[string]interface{} `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+			Security []map[string][]string `json:"security"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&spec))
+	assert.True(t, strings.HasPrefix(spec.OpenAPI, "3.0"))
+	assert.NotEmpty(t, spec.Info.Title)
+	assert.NotEmpty(t, spec.Info.Version)
+
+	search := spec.Paths["/search"]["get"]
+	assert.NotEmpty(t, search.Summary)
+	params := map[string]int{}
+	for i, p := range search.Parameters {
+		params[p.Name] = i
+		assert.Equal(t, "query", p.In)
+		assert.NotEmpty(t, p.Schema["type"], p.Name)
+	}
+	for _, name := range searchParams {
+		assert.Contains(t, params, name)
+	}
+	limit := search.Parameters[params["limit"]]
+	assert.True(t, limit.Required)
+	assert.Equal(t, "integer", limit.Schema["type"])
+	assert.EqualValues(t, 1, limit.Schema["minimum"])
+	assert.NotNil(t, limit.Example)
+	assert.Equal(t, []interface{}{"Id", "Age", "Name", "Score"}, search.Parameters[params["order_field"]].Schema["enum"])
+
+	users := search.Responses["200"].Content["application/json"].Schema
+	assert.Equal(t, "array", users["type"])
+	props := users["items"].(map[string]interface{})["properties"].(map[string]interface{})
+	for _, field := range []string{"Id", "Name", "Age", "About", "Gender", "Score"} {
+		assert.Contains(t, props, field)
+	}
+
+	countParams := []string{}
+	for _, p := range spec.Paths["/search/count"]["get"].Parameters {
+		countParams = append(countParams, p.Name)
+	}
+	assert.Contains(t, countParams, "query")
+	assert.NotContains(t, countParams, "limit")
+
+	byID := spec.Paths["/users/{id}"]
+	assert.Len(t, byID, 4)
+	assert.Equal(t, "path", byID["get"].Parameters[0].In)
+
+	config := spec.Paths["/admin/config"]["patch"]
+	assert.NotEmpty(t, config.Security)
+	assert.Contains(t, config.Responses, "401")
+
+	var documented []string
+	for path := range spec.Paths {
+		documented = append(documented, path)
+	}
+	sort.Strings(documented)
+	for _, path := range []string{"/search/count", "/changelog", "/capabilities", "/healthz", "/openapi.json", "/admin/import", "/dataset.xml"} {
+		assert.Contains(t, documented, path)
+	}
+}
+
+func TestOpenAPISpec_NoAdminWithoutToken(t *testing.T) {
+	spec, err := NewSearchServer().GenerateOpenAPISpec()
+	require.NoError(t, err)
+	var parsed map[string]interface{}
+	require.NoError(t, json.Unmarshal(spec, &parsed))
+	paths := parsed["paths"].(map[string]interface{})
+	assert.Contains(t, paths, "/search")
+	assert.NotContains(t, paths, "/admin/config")
+}
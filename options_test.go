@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ParamDoc - описание одного параметра /search в ответе на OPTIONS и в /openapi.json
+type ParamDoc struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Constraints string        `json:"constraints,omitempty"`
+	Default     string        `json:"default,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Minimum     *int          `json:"minimum,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	Example     interface{}   `json:"example,omitempty"`
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// searchParamDocs описывает параметры /search, ограничения берутся из текущих настроек сервера
+func (s *SearchServer) searchParamDocs() []ParamDoc {
+	cfg := s.settings()
+	limit := ParamDoc{Name: "limit", Type: "int", Constraints: "> 0", Required: true, Minimum: intPtr(1), Example: 25}
+	if s.NoLimitAllowed {
+		limit.Constraints = "> 0, or <= 0 for no limit"
+		limit.Minimum = nil
+	}
+	if cfg.MaxLimit > 0 {
+		limit.Constraints += ", capped at " + strconv.Itoa(cfg.MaxLimit)
+	}
+	queryLen := "length <= " + strconv.Itoa(cfg.MaxQueryLength)
+	return []ParamDoc{
+		limit,
+		{Name: "offset", Type: "int", Constraints: ">= 0", Required: true, Minimum: intPtr(0), Example: 0},
+		{Name: "query", Type: "string", Constraints: queryLen, Example: "Boyd"},
+		{Name: "queries", Type: "[]string", Constraints: "at most " + strconv.Itoa(maxQueries) + " values, " + queryLen, Example: []string{"Boyd", "Wolf"}},
+		{Name: "not_query", Type: "string", Constraints: queryLen + ", differs from query", Example: "Wolf"},
+		{Name: "gender", Type: "string", Constraints: "male, female", Enum: []interface{}{GenderMale, GenderFemale}},
+		{Name: "include_deleted", Type: "bool", Default: "false"},
+		{Name: "debug", Type: "bool", Default: "false"},
+		{Name: "order_field", Type: "string", Constraints: "Id, Age, Name, Score", Default: "Name",
+			Enum: []interface{}{"Id", "Age", "Name", "Score"}},
+		{Name: "order_by", Type: "int", Constraints: "-1, 0, 1", Required: true,
+			Enum: []interface{}{OrderByAsc, OrderByAsIs, OrderByDesc}, Example: OrderByAsc},
+		{Name: "order_criteria", Type: "json", Constraints: `[{"field":"Age","dir":-1}, ...], 1 to ` + strconv.Itoa(maxOrderCriteria) + " items, overrides order_field and order_by",
+			Example: `[{"field":"Age","dir":-1},{"field":"Name","dir":1}]`},
+		{Name: "since_id", Type: "int", Constraints: ">= 0", Default: "0", Minimum: intPtr(0)},
+		{Name: "min_score", Type: "float", Constraints: ">= 0, only with order_field=Score", Default: "0", Minimum: intPtr(0)},
+		{Name: "random_sample", Type: "int", Constraints: ">= 0", Default: "0", Minimum: intPtr(0)},
+		{Name: "seed", Type: "int64", Default: "current time", Example: 42},
+		{Name: "after_id", Type: "int", Constraints: ">= 0, only with order_field=Id", Minimum: intPtr(0)},
+		{Name: "before_id", Type: "int", Constraints: ">= 0, only with order_field=Id", Minimum: intPtr(0)},
+	}
+}
+
+// searchOptions отдаёт методы и параметры /search, чтобы клиенты могли узнать API, не читая документацию
+func (s *SearchServer) searchOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", strings.Join(searchMethods, ", "))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"methods": searchMethods, "params": s.searchParamDocs()})
+}
+
+func TestSearchOptions(t *testing.T) {
+	ts := NewTestServer(t)
+
+	req, err := http.NewRequest(http.MethodOptions, ts.URL+"/search", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "GET, HEAD, POST, OPTIONS", resp.Header.Get("Allow"))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var body struct {
+		Methods []string
+		Params  []ParamDoc
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	documented := map[string]bool{}
+	for _, p := range body.Params {
+		documented[p.Name] = true
+		assert.NotEmpty(t, p.Type, p.Name)
+	}
+	for _, name := range []string{"query", "order_field", "order_by", "limit", "offset"} {
+		assert.True(t, documented[name], name)
+	}
+	// всё, что понимает поиск, должно быть описано
+	for _, name := range searchParams {
+		assert.True(t, documented[name], name)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// OrderCriterion - один уровень составной сортировки из order_criteria.
+// Dir принимает те же значения, что order_by: OrderByAsc, OrderByDesc, OrderByAsIs (уровень пропускается)
+type OrderCriterion struct {
+	Field string `json:"field"`
+	Dir   int    `json:"dir"`
+}
+
+const maxOrderCriteria = 4
+
+// parseOrderCriteria разбирает и проверяет order_criteria, имена полей сначала проходят через resolve
+func parseOrderCriteria(v string, resolve func(string) string) ([]OrderCriterion, error) {
+	var criteria []OrderCriterion
+	if err := json.Unmarshal([]byte(v), &criteria); err != nil {
+		return nil, errors.New("invalid order_criteria")
+	}
+	if len(criteria) == 0 || len(criteria) > maxOrderCriteria {
+		return nil, fmt.Errorf("order_criteria must have 1 to %d items", maxOrderCriteria)
+	}
+	for i := range criteria {
+		criteria[i].Field = resolve(criteria[i].Field)
+		c := criteria[i]
+		if !validOrderFields[c.Field] {
+			return nil, fmt.Errorf("OrderField %s invalid", c.Field)
+		}
+		if err := ValidateOrderBy(c.Dir); err != nil {
+			return nil, err
+		}
+	}
+	return criteria, nil
+}
+
+// compareUsersBy сравнивает пользователей по одному полю по возрастанию
+func compareUsersBy(a, b User, field string, compareNames func(a, b string) int) int {
+	switch field {
+	case "Id":
+		return a.Id - b.Id
+	case "Age":
+		return a.Age - b.Age
+	case "Score":
+		switch {
+		case a.Score < b.Score:
+			return -1
+		case a.Score > b.Score:
+			return 1
+		}
+		return 0
+	case "Name":
+		return compareNames(a.Name, b.Name)
+	}
+	return 0
+}
+
+// sortByCriteria сортирует стабильно по criteria[0], при равенстве - по criteria[1] и так далее
+func sortByCriteria(users []User, criteria []OrderCriterion, compareNames func(a, b string) int) {
+	sort.SliceStable(users, func(i, j int) bool {
+		for _, c := range criteria {
+			if c.Dir == OrderByAsIs {
+				continue
+			}
+			cmp := compareUsersBy(users[i], users[j], c.Field, compareNames)
+			if c.Dir == OrderByDesc {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+}
+
+func TestSearch_OrderCriteria(t *testing.T) {
+	rows := []Row{
+		{ID: 1, FirstName: "Anna", Age: 30},
+		{ID: 2, FirstName: "Boris", Age: 20},
+		{ID: 3, FirstName: "Anna", Age: 20},
+		{ID: 4, FirstName: "Boris", Age: 20},
+		{ID: 5, FirstName: "Clara", Age: 30},
+		{ID: 6, FirstName: "Anna", Age: 20},
+	}
+	ts := NewTestServer(t, WithDataSet(DataSet{Rows: rows}))
+	search := func(params url.Values) (*http.Response, []int) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/search?" + params.Encode())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+		var users []User
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&users))
+		ids := []int{}
+		for _, u := range users {
+			ids = append(ids, u.Id)
+		}
+		return resp, ids
+	}
+	params := func(criteria string) url.Values {
+		return url.Values{
+			"limit": {"10"}, "offset": {"0"}, "order_field": {"Id"}, "order_by": {"-1"},
+			"order_criteria": {criteria},
+		}
+	}
+
+	// возраст по возрастанию, имя по убыванию, Id по убыванию; order_field/order_by игнорируются
+	_, ids := search(params(`[{"field":"Age","dir":-1},{"field":"Name","dir":1},{"field":"Id","dir":1}]`))
+	assert.Equal(t, []int{4, 2, 6, 3, 5, 1}, ids)
+
+	// без третьего уровня равные остаются в исходном порядке
+	_, ids = search(params(`[{"field":"Age","dir":-1},{"field":"Name","dir":1}]`))
+	assert.Equal(t, []int{2, 4, 3, 6, 5, 1}, ids)
+
+	for _, bad := range []string{`nope`, `[]`, `[{"field":"Email","dir":1}]`, `[{"field":"Age","dir":2}]`} {
+		resp, _ := search(params(bad))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, bad)
+	}
+}
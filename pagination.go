@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Pages - сколько страниц по pageSize нужно, чтобы показать totalCount пользователей (для "страница 3 из 7").
+// pageSize <= 0 - ошибка вызывающего, паника
+func Pages(totalCount, pageSize int) int {
+	if pageSize <= 0 {
+		panic(fmt.Sprintf("Pages: page size must be > 0, got %d", pageSize))
+	}
+	if totalCount <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(totalCount) / float64(pageSize)))
+}
+
+// PageOffset - Offset для страницы page (нумерация с 1), page < 1 считается первой страницей
+func PageOffset(page, pageSize int) int {
+	if page < 1 {
+		return 0
+	}
+	return (page - 1) * pageSize
+}
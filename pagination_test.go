@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPages(t *testing.T) {
+	cases := []struct {
+		total, size, want int
+	}{
+		{0, 25, 0},
+		{-5, 25, 0},
+		{1, 25, 1},
+		{25, 25, 1},
+		{26, 25, 2},
+		{35, 25, 2},
+		{35, 5, 7},
+		{36, 5, 8},
+		{35, 1, 35},
+		{1, 100, 1},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, Pages(c.total, c.size), "Pages(%d, %d)", c.total, c.size)
+	}
+
+	assert.Panics(t, func() { Pages(10, 0) })
+	assert.Panics(t, func() { Pages(10, -1) })
+}
+
+func TestPageOffset(t *testing.T) {
+	cases := []struct {
+		page, size, want int
+	}{
+		{1, 25, 0},
+		{2, 25, 25},
+		{3, 10, 20},
+		{7, 5, 30},
+		{0, 25, 0},
+		{-3, 25, 0},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, PageOffset(c.page, c.size), "PageOffset(%d, %d)", c.page, c.size)
+	}
+
+	// последняя страница по Pages начинается в пределах выдачи
+	total, size := 35, 10
+	assert.Less(t, PageOffset(Pages(total, size), size), total)
+	assert.GreaterOrEqual(t, PageOffset(Pages(total, size)+1, size), total)
+}
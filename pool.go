@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrPoolClosed = errors.New("search client pool is closed")
+
+// SearchClientPool раздаёт не больше size клиентов одновременно
+type SearchClientPool struct {
+	clients chan *SearchClient
+	all     []*SearchClient
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Pool создаёт size клиентов с одинаковыми настройками
+func Pool(size int, searchURL, token string, opts ...Option) (*SearchClientPool, error) {
+	if size <= 0 {
+		return nil, errors.New("pool size must be > 0")
+	}
+	p := &SearchClientPool{
+		clients: make(chan *SearchClient, size),
+		done:    make(chan struct{}),
+	}
+	for i := 0; i < size; i++ {
+		c, err := NewSearchClient(searchURL, token, opts...)
+		if err != nil {
+			return nil, err
+		}
+		p.all = append(p.all, c)
+		p.clients <- c
+	}
+	return p, nil
+}
+
+// Get ждёт свободного клиента, после закрытия пула возвращает nil
+func (p *SearchClientPool) Get() *SearchClient {
+	c, _ := p.get(context.Background())
+	return c
+}
+
+func (p *SearchClientPool) get(ctx context.Context) (*SearchClient, error) {
+	select {
+	case <-p.done:
+		return nil, ErrPoolClosed
+	default:
+	}
+	select {
+	case c := <-p.clients:
+		return c, nil
+	case <-p.done:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Put возвращает клиента, полученного через Get
+func (p *SearchClientPool) Put(c *SearchClient) {
+	if c == nil {
+		return
+	}
+	select {
+	case p.clients <- c:
+	case <-p.done:
+	}
+}
+
+// With берёт клиента, вызывает fn и возвращает клиента в пул
+func (p *SearchClientPool) With(ctx context.Context, fn func(*SearchClient) error) error {
+	c, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Put(c)
+	return fn(c)
+}
+
+// Close закрывает все клиенты пула, ждущие Get получают nil
+func (p *SearchClientPool) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.done)
+		for _, c := range p.all {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchClientPool_MaxOutstanding(t *testing.T) {
+	ts := NewTestServer(t)
+	const size = 3
+	p, err := Pool(size, ts.URL, "test_token", WithTimeout(time.Second))
+	require.NoError(t, err)
+	defer p.Close()
+
+	var outstanding, maxSeen int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.With(context.Background(), func(c *SearchClient) error {
+				n := atomic.AddInt32(&outstanding, 1)
+				for {
+					m := atomic.LoadInt32(&maxSeen)
+					if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+						break
+					}
+				}
+				defer atomic.AddInt32(&outstanding, -1)
+				_, err := c.FindUsers(SearchRequest{Limit: 1})
+				time.Sleep(5 * time.Millisecond)
+				return err
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(size), maxSeen)
+}
+
+func TestSearchClientPool_GetPut(t *testing.T) {
+	p, err := Pool(1, "http://localhost", "test_token")
+	require.NoError(t, err)
+
+	c := p.Get()
+	require.NotNil(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = p.With(ctx, func(*SearchClient) error { return nil })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	got := make(chan *SearchClient)
+	go func() { got <- p.Get() }()
+	p.Put(c)
+	assert.Same(t, c, <-got)
+
+	go func() { got <- p.Get() }()
+	require.NoError(t, p.Close())
+	assert.Nil(t, <-got)
+	assert.Nil(t, p.Get())
+	assert.ErrorIs(t, p.With(context.Background(), func(*SearchClient) error { return nil }), ErrPoolClosed)
+	p.Put(c)
+	require.NoError(t, p.Close())
+}
+
+func TestPool_Errors(t *testing.T) {
+	_, err := Pool(0, "http://localhost", "test_token")
+	assert.Error(t, err)
+	_, err = Pool(2, "://bad", "test_token", WithDNSPreResolve())
+	assert.Error(t, err)
+}
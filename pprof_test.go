@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// WithProfiling вешает net/http/pprof на /debug/pprof/, пускает только с Authorization: Bearer <secret>.
+// Пустой secret - ручки нет совсем
+func WithProfiling(secret string) ServerOption {
+	return func(s *SearchServer) {
+		s.profilingSecret = secret
+	}
+}
+
+func (s *SearchServer) registerProfiling() {
+	if s.profilingSecret == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	s.mux.Handle("/debug/pprof/", bearerAuth(s.profilingSecret)(mux))
+}
+
+func TestWithProfiling(t *testing.T) {
+	get := func(url, auth string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	ts := NewTestServer(t, WithProfiling("s3cret"))
+	assert.Equal(t, http.StatusUnauthorized, get(ts.URL+"/debug/pprof/", ""))
+	assert.Equal(t, http.StatusUnauthorized, get(ts.URL+"/debug/pprof/", "Bearer wrong"))
+	assert.Equal(t, http.StatusOK, get(ts.URL+"/debug/pprof/", "Bearer s3cret"))
+	assert.Equal(t, http.StatusOK, get(ts.URL+"/debug/pprof/cmdline", "Bearer s3cret"))
+
+	disabled := NewTestServer(t, WithProfiling(""))
+	assert.Equal(t, http.StatusNotFound, get(disabled.URL+"/debug/pprof/", "Bearer "))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// WithHTTP2Push включает экспериментальный push следующей страницы поиска по HTTP/2.
+// Стандартный http.Transport push не принимает, так что пользу от него получат только сторонние клиенты:
+// SearchClient обещанные страницы не кэширует и за следующей страницей всегда ходит сам
+func WithHTTP2Push(enabled bool) ServerOption {
+	return func(s *SearchServer) {
+		s.http2Push = enabled
+	}
+}
+
+// pushNextPage обещает клиенту следующую страницу с тем же limit, если она есть.
+// Ошибки push не важны: клиент мог его запретить, тогда он просто сходит сам
+func pushNextPage(w http.ResponseWriter, r *http.Request, page searchPage, total int) {
+	pusher, ok := w.(http.Pusher)
+	if !ok || page.noLimit || page.offset+page.limit >= total {
+		return
+	}
+	params := url.Values{}
+	for k, v := range r.Form {
+		params[k] = v
+	}
+	params.Set("offset", strconv.Itoa(page.offset+page.limit))
+	opts := &http.PushOptions{Header: http.Header{}}
+	for _, h := range []string{"AccessToken", "Authorization"} {
+		if v := r.Header.Get(h); v != "" {
+			opts.Header.Set(h, v)
+		}
+	}
+	pusher.Push(r.URL.Path+"?"+params.Encode(), opts)
+}
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestHTTP2Push_NextPage(t *testing.T) {
+	s := NewSearchServer(WithHTTP2Push(true))
+	search := func(target string) *pushRecorder {
+		rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec
+	}
+
+	rec := search("/search?limit=2&offset=0&order_by=0&query=Boyd")
+	assert.Empty(t, rec.pushed, "no next page")
+
+	rec = search("/search?limit=2&offset=4&order_by=1&order_field=Id")
+	require.Len(t, rec.pushed, 1)
+	pushed, err := url.Parse(rec.pushed[0])
+	require.NoError(t, err)
+	assert.Equal(t, "/search", pushed.Path)
+	assert.Equal(t, "6", pushed.Query().Get("offset"))
+	assert.Equal(t, "2", pushed.Query().Get("limit"))
+	assert.Equal(t, "Id", pushed.Query().Get("order_field"))
+
+	rec = &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	NewSearchServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?limit=2&offset=0&order_by=0", nil))
+	assert.Empty(t, rec.pushed, "push is off by default")
+}
+
+// pushProbe запоминает, чем закончились попытки push на настоящем соединении
+type pushProbe struct {
+	http.ResponseWriter
+	proto int
+	errs  []error
+}
+
+func (p *pushProbe) Push(target string, opts *http.PushOptions) error {
+	err := p.ResponseWriter.(http.Pusher).Push(target, opts)
+	p.errs = append(p.errs, err)
+	return err
+}
+
+// SearchClient push не принимает: http.Transport сам выключает его в настройках HTTP/2,
+// поэтому сервер честно пытается, получает отказ и клиент ходит за следующей страницей сам
+func TestHTTP2Push_RefusedByGoClient(t *testing.T) {
+	s := NewSearchServer(WithHTTP2Push(true))
+	var probe pushProbe
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probe.ResponseWriter, probe.proto = w, r.ProtoMajor
+		s.ServeHTTP(&probe, r)
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	sc, err := NewSearchClientFromHTTPClient(ts.Client(), ts.URL, "test_token")
+	require.NoError(t, err)
+	resp, err := sc.FindUsers(SearchRequest{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, resp.Users, 2)
+	assert.True(t, resp.NextPage)
+
+	assert.Equal(t, 2, probe.proto)
+	require.Len(t, probe.errs, 1, "server must try to push the next page")
+	assert.ErrorIs(t, probe.errs[0], http.ErrNotSupported)
+}
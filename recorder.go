@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RequestStore получает каждый поиск клиента после его завершения, см. WithRequestRecorder.
+// Record вызывается из тех же горутин, что и Do, так что реализация должна быть потокобезопасной
+type RequestStore interface {
+	Record(req SearchRequest, resp *SearchResponse, duration time.Duration, err error)
+}
+
+// WithRequestRecorder отдаёт в store каждый вызов FindUsers/Do: запрос в том виде, в каком его передали,
+// ответ или ошибку и сколько он занял
+func WithRequestRecorder(store RequestStore) Option {
+	return func(srv *SearchClient) error {
+		srv.recorder = store
+		return nil
+	}
+}
+
+// RecordedRequest - один записанный поиск
+type RecordedRequest struct {
+	At       time.Time
+	Request  SearchRequest
+	Response *SearchResponse
+	Duration time.Duration
+	Err      error
+}
+
+// MemoryRequestStore держит в памяти последние maxEntries поисков, старые вытесняются
+type MemoryRequestStore struct {
+	mu      sync.Mutex
+	max     int
+	entries []RecordedRequest
+	// куда писать следующую запись, когда буфер уже заполнен
+	next int
+}
+
+// InMemoryRequestStore создаёт хранилище на maxEntries последних поисков, maxEntries <= 0 - без ограничения
+func InMemoryRequestStore(maxEntries int) *MemoryRequestStore {
+	return &MemoryRequestStore{max: maxEntries}
+}
+
+func (s *MemoryRequestStore) Record(req SearchRequest, resp *SearchResponse, duration time.Duration, err error) {
+	if resp != nil {
+		resp = resp.clone()
+	}
+	e := RecordedRequest{At: time.Now(), Request: req, Response: resp, Duration: duration, Err: err}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.max <= 0 || len(s.entries) < s.max {
+		s.entries = append(s.entries, e)
+		return
+	}
+	s.entries[s.next] = e
+	s.next = (s.next + 1) % s.max
+}
+
+// Entries возвращает записи от старых к новым
+func (s *MemoryRequestStore) Entries() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(append([]RecordedRequest(nil), s.entries[s.next:]...), s.entries[:s.next]...)
+}
+
+// Slowest возвращает n самых долгих записей, от самой долгой
+func (s *MemoryRequestStore) Slowest(n int) []RecordedRequest {
+	entries := s.Entries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Duration > entries[j].Duration
+	})
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// ErrorRate - доля записей с ошибкой, 0 если записей нет
+func (s *MemoryRequestStore) ErrorRate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, e := range s.entries {
+		if e.Err != nil {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(s.entries))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRecorder(t *testing.T) {
+	ts := NewTestServer(t)
+	store := InMemoryRequestStore(100)
+	sc, err := NewSearchClient(ts.URL, "test_token", WithRequestRecorder(store))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// каждый третий запрос уходит мимо поиска, а шестой ещё и тормозит
+	for i := 0; i < 10; i++ {
+		i := i
+		_, err := sc.Do(ctx, SearchRequest{Limit: 1, Offset: i}, func(r *http.Request) {
+			if i%3 == 0 {
+				r.URL.Path = "/missing"
+			}
+			if i == 5 {
+				time.Sleep(30 * time.Millisecond)
+			}
+		})
+		assert.Equal(t, i%3 == 0, err != nil, i)
+	}
+
+	entries := store.Entries()
+	require.Len(t, entries, 10)
+	assert.InDelta(t, 0.4, store.ErrorRate(), 1e-9)
+	for i, e := range entries {
+		assert.Equal(t, i, e.Request.Offset, "entries are in call order")
+		assert.Equal(t, i%3 == 0, e.Err != nil, i)
+		assert.Equal(t, e.Err == nil, e.Response != nil, i)
+		assert.Positive(t, e.Duration)
+	}
+	assert.Len(t, entries[1].Response.Users, 1)
+
+	slowest := store.Slowest(2)
+	require.Len(t, slowest, 2)
+	assert.Equal(t, 5, slowest[0].Request.Offset)
+	assert.GreaterOrEqual(t, slowest[0].Duration, slowest[1].Duration)
+	assert.Len(t, store.Slowest(100), 10)
+}
+
+func TestInMemoryRequestStore(t *testing.T) {
+	store := InMemoryRequestStore(3)
+	assert.Zero(t, store.ErrorRate())
+	assert.Empty(t, store.Entries())
+
+	for i := 0; i < 5; i++ {
+		var err error
+		if i == 4 {
+			err = errors.New("boom")
+		}
+		store.Record(SearchRequest{Query: strconv.Itoa(i)}, nil, time.Duration(i), err)
+	}
+	var queries []string
+	for _, e := range store.Entries() {
+		queries = append(queries, e.Request.Query)
+	}
+	assert.Equal(t, []string{"2", "3", "4"}, queries, "oldest entries are evicted")
+	assert.InDelta(t, 1.0/3, store.ErrorRate(), 1e-9)
+
+	resp := &SearchResponse{Users: []User{{Id: 1}}}
+	store.Record(SearchRequest{}, resp, 0, nil)
+	resp.Users[0].Id = 2
+	assert.Equal(t, 1, store.Entries()[2].Response.Users[0].Id, "store keeps its own copy")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// ReplayLog заново выполняет записанные запросы, не больше concurrency одновременно.
+// Ответы и ошибки лежат по тем же индексам, что и запросы в log; при ошибке ответ - нулевой SearchResponse.
+// Запросы, до которых не дошла очередь после отмены ctx, получают ctx.Err()
+func (srv *SearchClient) ReplayLog(ctx context.Context, log []SearchRequest, concurrency int) ([]SearchResponse, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	responses := make([]SearchResponse, len(log))
+	errs := make([]error, len(log))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				resp, err := srv.Do(ctx, log[i], nil)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				responses[i] = *resp
+			}
+		}()
+	}
+	for i := range log {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return responses, errs
+}
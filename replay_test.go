@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayLog(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	log := make([]SearchRequest, 50)
+	for i := range log {
+		log[i] = SearchRequest{Limit: 1, Offset: i % len(dataset.Rows), OrderField: "Id", OrderBy: OrderByAsc}
+	}
+	// один заведомо плохой запрос, его ошибка должна остаться на своём месте
+	log[17].OrderField = "Unknown"
+
+	responses, errs := sc.ReplayLog(context.Background(), log, 10)
+	require.Len(t, responses, len(log))
+	require.Len(t, errs, len(log))
+	for i := range log {
+		if i == 17 {
+			assert.Error(t, errs[i])
+			assert.Empty(t, responses[i].Users)
+			continue
+		}
+		require.NoError(t, errs[i], i)
+		require.Len(t, responses[i].Users, 1, i)
+		assert.Equal(t, log[i].Offset, responses[i].Users[0].Id, i)
+	}
+}
+
+func TestReplayLog_Cancelled(t *testing.T) {
+	ts := NewTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, errs := ts.SearchClient("test_token").ReplayLog(ctx, []SearchRequest{{Limit: 1}, {Limit: 1}}, 0)
+	for _, err := range errs {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+	assert.Empty(t, ts.received)
+}
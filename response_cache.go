@@ -0,0 +1,144 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// responseCache - LRU ответов поиска по ключу запроса, записи старше ttl считаются промахом
+type responseCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type responseCacheEntry struct {
+	key      string
+	resp     SearchResponse
+	storedAt time.Time
+}
+
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	return &responseCache{size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *responseCache) get(key string) (*SearchResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*responseCacheEntry)
+	if c.ttl > 0 && time.Since(e.storedAt) > c.ttl {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.resp.clone(), true
+}
+
+func (c *responseCache) put(key string, resp *SearchResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &responseCacheEntry{key: key, resp: *resp.clone(), storedAt: time.Now()}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+}
+
+func (c *responseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+// WithResponseCache включает кеш последних size ответов: повтор запроса в пределах ttl не ходит на сервер вовсе.
+// ttl == 0 - записи не устаревают, пока их не вытеснят или не вызовут InvalidateCache.
+// Запросы через Do с mutate кеш не используют
+func WithResponseCache(size int, ttl time.Duration) Option {
+	return func(srv *SearchClient) error {
+		if size <= 0 {
+			return fmt.Errorf("response cache size must be > 0")
+		}
+		srv.cache = newResponseCache(size, ttl)
+		return nil
+	}
+}
+
+const defaultMaxConcurrency = 4
+
+// WithMaxConcurrency ограничивает число одновременных запросов в WarmupQueries, по умолчанию defaultMaxConcurrency
+func WithMaxConcurrency(n int) Option {
+	return func(srv *SearchClient) error {
+		if n <= 0 {
+			return fmt.Errorf("max concurrency must be > 0")
+		}
+		srv.maxConcurrency = n
+		return nil
+	}
+}
+
+// WarmupQueries заранее выполняет запросы, чтобы их ответы оказались в кеше WithResponseCache.
+// Возвращает, сколько запросов закешировано; упавшие пропускаются с записью в лог.
+// Ошибка - только если кеш не включён или ctx отменён
+func (srv *SearchClient) WarmupQueries(ctx context.Context, queries []SearchRequest) (int, error) {
+	if srv.cache == nil {
+		return 0, fmt.Errorf("response cache is disabled, see WithResponseCache")
+	}
+	concurrency := srv.maxConcurrency
+	if concurrency == 0 {
+		concurrency = defaultMaxConcurrency
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		cached int
+	)
+	sem := make(chan struct{}, concurrency)
+	for i, req := range queries {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return cached, ctx.Err()
+		}
+		wg.Add(1)
+		go func(i int, req SearchRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := srv.Do(ctx, req, nil); err != nil {
+				slog.Default().Warn("warmup query failed", "index", i, "error", err)
+				return
+			}
+			mu.Lock()
+			cached++
+			mu.Unlock()
+		}(i, req)
+	}
+	wg.Wait()
+	return cached, ctx.Err()
+}
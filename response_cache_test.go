@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmupQueries(t *testing.T) {
+	ts := NewTestServer(t)
+	sc, err := NewSearchClient(ts.URL, "test_token", WithResponseCache(10, time.Minute), WithMaxConcurrency(2))
+	require.NoError(t, err)
+
+	hot := []SearchRequest{
+		{Limit: 5, Query: "Boyd"},
+		{Limit: 5, Query: "Hilda"},
+		{Limit: 5, OrderField: "Age", OrderBy: OrderByAsc},
+		{Limit: 5, OrderField: "Unknown"},
+	}
+	n, err := sc.WarmupQueries(context.Background(), hot)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "failed query is skipped")
+	ts.received = nil
+
+	res, err := sc.FindUsers(hot[0])
+	require.NoError(t, err)
+	require.Len(t, res.Users, 1)
+	assert.Equal(t, "Boyd Wolf", res.Users[0].Name)
+	res, err = sc.FindUsers(hot[2])
+	require.NoError(t, err)
+	assert.Len(t, res.Users, 5)
+	assert.Empty(t, ts.received, "warmed queries must not hit the server")
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 5, Query: "cold"})
+	require.NoError(t, err)
+	assert.Len(t, ts.received, 1)
+
+	sc.InvalidateCache()
+	_, err = sc.FindUsers(hot[0])
+	require.NoError(t, err)
+	assert.Len(t, ts.received, 2)
+
+	_, err = ts.SearchClient("test_token").WarmupQueries(context.Background(), hot)
+	assert.Error(t, err, "warmup without cache")
+}
+
+func TestResponseCache_LRU(t *testing.T) {
+	c := newResponseCache(2, 0)
+	c.put("a", &SearchResponse{TotalCount: 1})
+	c.put("b", &SearchResponse{TotalCount: 2})
+	_, ok := c.get("a")
+	require.True(t, ok)
+	c.put("c", &SearchResponse{TotalCount: 3})
+
+	assert.Equal(t, 2, c.len())
+	_, ok = c.get("b")
+	assert.False(t, ok, "least recently used is evicted")
+	res, ok := c.get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, res.TotalCount)
+
+	c = newResponseCache(2, time.Millisecond)
+	c.put("a", &SearchResponse{})
+	time.Sleep(5 * time.Millisecond)
+	_, ok = c.get("a")
+	assert.False(t, ok, "expired")
+}
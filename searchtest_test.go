@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServer - обёртка над httptest.Server с нашим SearchServer внутри,
+// запоминает все пришедшие поисковые запросы, чтобы их можно было проверить в тесте.
+// Отдельным пакетом сделать не получится - package main нельзя импортировать
+type TestServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	received []SearchRequest
+}
+
+func NewTestServer(t testing.TB, opts ...ServerOption) *TestServer {
+	t.Helper()
+	srv := NewSearchServer(opts...)
+	ts := &TestServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" || r.URL.Path == "/search" {
+			ts.record(r)
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *TestServer) SearchClient(token string) *SearchClient {
+	return &SearchClient{AccessToken: token, URL: ts.URL}
+}
+
+func (ts *TestServer) record(r *http.Request) {
+	req := SearchRequest{
+		Query:          r.FormValue("query"),
+		NotQuery:       r.FormValue("not_query"),
+		Queries:        r.Form["queries"],
+		Gender:         Gender(r.FormValue("gender")),
+		IncludeDeleted: r.FormValue("include_deleted") == "true",
+		Debug:          r.FormValue("debug") == "true",
+		OrderField:     r.FormValue("order_field"),
+	}
+	for _, f := range r.Form["fields"] {
+		req.Fields = append(req.Fields, UserField(f))
+	}
+	req.Limit, _ = strconv.Atoi(r.FormValue("limit"))
+	req.Offset, _ = strconv.Atoi(r.FormValue("offset"))
+	req.OrderBy, _ = strconv.Atoi(r.FormValue("order_by"))
+	req.SinceID, _ = strconv.Atoi(r.FormValue("since_id"))
+	req.FuzzyDistance, _ = strconv.Atoi(r.FormValue("fuzzy_distance"))
+	req.MinScore, _ = strconv.ParseFloat(r.FormValue("min_score"), 64)
+	req.RandomSample, _ = strconv.Atoi(r.FormValue("random_sample"))
+	req.Seed, _ = strconv.ParseInt(r.FormValue("seed"), 10, 64)
+	req.AfterID, _ = strconv.Atoi(r.FormValue("after_id"))
+	req.BeforeID, _ = strconv.Atoi(r.FormValue("before_id"))
+
+	ts.mu.Lock()
+	ts.received = append(ts.received, req)
+	ts.mu.Unlock()
+}
+
+// AssertNextRequest проверяет самый старый ещё не проверенный запрос.
+// Сравниваются параметры в том виде, в каком они пришли на сервер (limit уже с +1 от клиента)
+func (ts *TestServer) AssertNextRequest(t testing.TB, want SearchRequest) bool {
+	t.Helper()
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if len(ts.received) == 0 {
+		return assert.Fail(t, "no requests received by test server")
+	}
+	got := ts.received[0]
+	ts.received = ts.received[1:]
+	return assert.Equal(t, want, got)
+}
+
+// EqualSearchResponse проверяет ответы через SearchResponse.Equal, то есть без учёта порядка пользователей
+func EqualSearchResponse(t testing.TB, expected, actual SearchResponse) bool {
+	t.Helper()
+	if expected.Equal(actual) {
+		return true
+	}
+	return assert.Fail(t, "search responses are not equal",
+		"expected: %+v\nactual:   %+v", expected, actual)
+}
+
+// ExpectUsers ищет по req и проверяет, что нашлись ровно пользователи wantIDs, порядок не важен.
+// При расхождении показывает, какие Id пришли лишними, а какие не пришли
+func (srv *SearchClient) ExpectUsers(t testing.TB, req SearchRequest, wantIDs []int) bool {
+	t.Helper()
+	resp, err := srv.FindUsers(req)
+	if !assert.NoError(t, err, "search %s", req.values().Encode()) {
+		return false
+	}
+
+	// считаем повторы, чтобы дубль в выдаче тоже был расхождением
+	left := make(map[int]int, len(wantIDs))
+	for _, id := range wantIDs {
+		left[id]++
+	}
+	var unexpected []int
+	for _, u := range resp.Users {
+		if left[u.Id] > 0 {
+			left[u.Id]--
+			continue
+		}
+		unexpected = append(unexpected, u.Id)
+	}
+	var missing []int
+	for _, id := range wantIDs {
+		if left[id] > 0 {
+			left[id]--
+			missing = append(missing, id)
+		}
+	}
+	if len(unexpected) == 0 && len(missing) == 0 {
+		return true
+	}
+	sort.Ints(unexpected)
+	sort.Ints(missing)
+	return assert.Fail(t, "found users differ from expected",
+		"search:     %s\nunexpected: %v\nmissing:    %v", req.values().Encode(), unexpected, missing)
+}
+
+// recordingT запоминает сообщения об ошибках вместо того, чтобы валить тест
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectUsers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("query") == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode([]User{{Id: 3}, {Id: 1}, {Id: 2}})
+	}))
+	defer ts.Close()
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+	req := SearchRequest{Limit: 10}
+
+	assert.True(t, sc.ExpectUsers(t, req, []int{1, 2, 3}))
+	assert.True(t, sc.ExpectUsers(t, req, []int{2, 3, 1}))
+
+	for _, tt := range []struct {
+		want       []int
+		unexpected string
+		missing    string
+	}{
+		{[]int{1, 2}, "unexpected: [3]", "missing:    []"},
+		{[]int{1, 2, 3, 4, 5}, "unexpected: []", "missing:    [4 5]"},
+		{[]int{5, 1, 4}, "unexpected: [2 3]", "missing:    [4 5]"},
+		{[]int{1, 1, 2, 3}, "unexpected: []", "missing:    [1]"},
+	} {
+		mock := &recordingT{TB: t}
+		assert.False(t, sc.ExpectUsers(mock, req, tt.want))
+		require.Len(t, mock.errors, 1)
+		assert.Contains(t, mock.errors[0], tt.unexpected, tt.want)
+		assert.Contains(t, mock.errors[0], tt.missing, tt.want)
+	}
+
+	mock := &recordingT{TB: t}
+	assert.False(t, sc.ExpectUsers(mock, SearchRequest{Limit: 10, Query: "fail"}, nil))
+	require.Len(t, mock.errors, 1)
+	assert.Contains(t, mock.errors[0], "SearchServer fatal error")
+}
+
+func TestNewTestServer(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	_, err := sc.FindUsers(SearchRequest{Limit: 5, Offset: 2, Query: "Wolf", OrderField: "Age", OrderBy: OrderByDesc})
+	require.NoError(t, err)
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+
+	ts.AssertNextRequest(t, SearchRequest{Limit: 6, Offset: 2, Query: "Wolf", OrderField: "Age", OrderBy: OrderByDesc})
+	ts.AssertNextRequest(t, SearchRequest{Limit: 2})
+
+	mock := &recordingT{TB: t}
+	assert.False(t, ts.AssertNextRequest(mock, SearchRequest{}))
+	require.Len(t, mock.errors, 1)
+	assert.Contains(t, mock.errors[0], "no requests received by test server")
+}
+
+func TestNewTestServer_RecordsAllFields(t *testing.T) {
+	ts := NewTestServer(t)
+
+	// нечёткий поиск тестовый сервер не умеет, и клиент такой запрос не отправит, поэтому шлём форму напрямую
+	req := SearchRequest{
+		Limit: 3, Offset: 1, Query: "Wolf", NotQuery: "Boyd", Queries: []string{"Hilda"}, OrderField: "Id", OrderBy: OrderByAsc,
+		Gender: GenderMale, IncludeDeleted: true, Debug: true, Fields: []UserField{UserFieldID, UserFieldName},
+		SinceID: 2, FuzzyDistance: 1, MinScore: 0.5, RandomSample: 10, Seed: 42, AfterID: 1, BeforeID: 30,
+	}
+	// новое поле в SearchRequest должно попасть и сюда, и в record
+	v := reflect.ValueOf(req)
+	for i := 0; i < v.NumField(); i++ {
+		require.False(t, v.Field(i).IsZero(), "field %s is not set", v.Type().Field(i).Name)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/search?" + req.values().Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	ts.AssertNextRequest(t, req)
+}
+
+func TestNewTestServer_Options(t *testing.T) {
+	ts := NewTestServer(t, WithNoLimitAllowed(true))
+	var n int
+	err := ts.SearchClient("test_token").StreamUsers(context.Background(), SearchRequest{}, func(User) error {
+		n++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, len(dataset.Rows), n)
+	ts.AssertNextRequest(t, SearchRequest{Limit: -1})
+
+	ts.Close()
+}
+
+func TestSearchResponseEqual(t *testing.T) {
+	a := User{Id: 1, Name: "A"}
+	b := User{Id: 2, Name: "B"}
+	base := SearchResponse{Users: []User{a, b}, NextPage: true, TotalCount: 5}
+
+	cases := []struct {
+		name  string
+		other SearchResponse
+		equal bool
+	}{
+		{"Same", SearchResponse{Users: []User{a, b}, NextPage: true, TotalCount: 5}, true},
+		{"OtherOrder", SearchResponse{Users: []User{b, a}, NextPage: true, TotalCount: 5}, true},
+		{"NextPageDiffers", SearchResponse{Users: []User{a, b}, TotalCount: 5}, false},
+		{"TotalDiffers", SearchResponse{Users: []User{a, b}, NextPage: true, TotalCount: 4}, false},
+		{"MissingUser", SearchResponse{Users: []User{a}, NextPage: true, TotalCount: 5}, false},
+		{"DuplicateUser", SearchResponse{Users: []User{a, a}, NextPage: true, TotalCount: 5}, false},
+		{"ChangedUser", SearchResponse{Users: []User{a, {Id: 2, Name: "C"}}, NextPage: true, TotalCount: 5}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.equal, base.Equal(c.other))
+			assert.Equal(t, c.equal, c.other.Equal(base))
+		})
+	}
+}
+
+func TestEqualSearchResponse(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+
+	asc, err := sc.FindUsers(SearchRequest{Limit: 25, Query: "nulla", OrderField: "Id", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	desc, err := sc.FindUsers(SearchRequest{Limit: 25, Query: "nulla", OrderField: "Id", OrderBy: OrderByDesc})
+	require.NoError(t, err)
+	require.False(t, asc.NextPage)
+	assert.Equal(t, len(asc.Users), asc.TotalCount)
+	assert.NotEqual(t, asc.Users, desc.Users)
+
+	EqualSearchResponse(t, *asc, *desc)
+	mock := &recordingT{TB: t}
+	assert.False(t, EqualSearchResponse(mock, *asc, SearchResponse{}))
+	require.Len(t, mock.errors, 1)
+	assert.Contains(t, mock.errors[0], "search responses are not equal")
+}
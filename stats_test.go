@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// FieldStats считается один раз при загрузке датасета.
+// Min/Max/Mean/Median заполняются только для числовых полей
+type FieldStats struct {
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Mean        float64 `json:"mean"`
+	Median      float64 `json:"median"`
+	UniqueCount int     `json:"unique_count"`
+}
+
+func computeFieldStats(rows []Row) map[string]FieldStats {
+	ages := make([]float64, 0, len(rows))
+	ids := make([]float64, 0, len(rows))
+	genders := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ages = append(ages, float64(row.Age))
+		ids = append(ids, float64(row.ID))
+		genders = append(genders, row.Gender)
+	}
+	return map[string]FieldStats{
+		"age":    numericStats(ages),
+		"id":     numericStats(ids),
+		"gender": stringStats(genders),
+	}
+}
+
+func numericStats(values []float64) FieldStats {
+	st := FieldStats{}
+	if len(values) == 0 {
+		return st
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	unique := map[float64]bool{}
+	for _, v := range sorted {
+		sum += v
+		unique[v] = true
+	}
+	st.Min = sorted[0]
+	st.Max = sorted[len(sorted)-1]
+	st.Mean = sum / float64(len(sorted))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		st.Median = (sorted[mid-1] + sorted[mid]) / 2
+	} else {
+		st.Median = sorted[mid]
+	}
+	st.UniqueCount = len(unique)
+	return st
+}
+
+func stringStats(values []string) FieldStats {
+	unique := map[string]bool{}
+	for _, v := range values {
+		unique[v] = true
+	}
+	return FieldStats{UniqueCount: len(unique)}
+}
+
+func (s *SearchServer) fieldStats(w http.ResponseWriter, r *http.Request) {
+	field := strings.TrimPrefix(r.URL.Path, "/stats/fields/")
+	st, ok := s.data().Stats[field]
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		http.Error(w, `{"error": "unknown field"}`, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(st)
+}
+
+func TestFieldStats(t *testing.T) {
+	ts := NewTestServer(t)
+
+	get := func(field string) (FieldStats, int) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/stats/fields/" + field)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var st FieldStats
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+		}
+		return st, resp.StatusCode
+	}
+
+	age, code := get("age")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, age.Min <= age.Median && age.Median <= age.Max)
+	assert.True(t, age.Min <= age.Mean && age.Mean <= age.Max)
+
+	id, code := get("id")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0.0, id.Min)
+	assert.Equal(t, float64(len(dataset.Rows)-1), id.Max)
+	assert.Equal(t, len(dataset.Rows), id.UniqueCount)
+
+	gender, code := get("gender")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, gender.UniqueCount)
+
+	_, code = get("name")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestNumericStats(t *testing.T) {
+	assert.Equal(t, FieldStats{}, numericStats(nil))
+	assert.Equal(t, FieldStats{Min: 1, Max: 4, Mean: 2.5, Median: 2.5, UniqueCount: 4}, numericStats([]float64{4, 1, 3, 2}))
+	assert.Equal(t, FieldStats{Min: 1, Max: 9, Mean: 4, Median: 2, UniqueCount: 3}, numericStats([]float64{9, 1, 2}))
+}
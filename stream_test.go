@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// WithStreaming включает потоковую выдачу поиска: массив пишется по одному пользователю со сбросом
+// после каждого, так что первый байт уходит, не дожидаясь кодирования всей выдачи.
+// Content-Length при этом не известен, и ответ идёт с Transfer-Encoding: chunked.
+// С WithResponseEnvelope не сочетается
+func WithStreaming(enabled bool) ServerOption {
+	return func(s *SearchServer) {
+		s.streaming = enabled
+	}
+}
+
+// streamUsers пишет users JSON-массивом, байт в байт как json.Marshal и перевод строки,
+// сбрасывая каждого пользователя клиенту, если w это умеет. Возвращает число записанных байт
+func streamUsers(w http.ResponseWriter, users []User) (int, error) {
+	flusher, _ := w.(http.Flusher)
+	n, err := io.WriteString(w, "[")
+	if err != nil {
+		return n, err
+	}
+	for i, u := range users {
+		chunk, err := json.Marshal(u)
+		if err != nil {
+			return n, err
+		}
+		if i > 0 {
+			chunk = append([]byte{','}, chunk...)
+		}
+		m, err := w.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	m, err := io.WriteString(w, "]\n")
+	return n + m, err
+}
+
+// slowFlusher притормаживает после каждого сброса, как будто следующего пользователя долго кодировать
+type slowFlusher struct {
+	http.ResponseWriter
+	delay time.Duration
+}
+
+func (w slowFlusher) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+	time.Sleep(w.delay)
+}
+
+func TestSearch_Streaming(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	s := NewSearchServer(WithStreaming(true))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.ServeHTTP(slowFlusher{w, delay}, r)
+	}))
+	defer ts.Close()
+	const query = "/?limit=5&offset=0&order_field=Id&order_by=-1"
+
+	resp, err := http.Get(ts.URL + query)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	// каждый пользователь кончается на '}' верхнего уровня, засекаем, когда он дочитан
+	var (
+		body    []byte
+		arrived []time.Time
+		depth   int
+	)
+	br := bufio.NewReader(resp.Body)
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body = append(body, b)
+		switch b {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				arrived = append(arrived, time.Now())
+			}
+		}
+	}
+	require.Len(t, arrived, 5)
+	assert.GreaterOrEqual(t, arrived[4].Sub(arrived[0]), 3*delay, "first user must arrive before the last one is encoded")
+
+	// поток ничем не отличается от обычного ответа
+	rec := httptest.NewRecorder()
+	NewSearchServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, query, nil))
+	assert.Equal(t, rec.Body.String(), string(body))
+
+	// пустая выдача - пустой массив, без лишних запятых
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, query+"&query=nobody-has-this-name", nil))
+	assert.Equal(t, "[]\n", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("Content-Length"))
+}
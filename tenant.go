@@ -0,0 +1,17 @@
+package main
+
+import "context"
+
+type tenantKey struct{}
+
+// WithTenantScope кладёт в контекст арендатора: клиент с таким контекстом шлёт X-Tenant-ID,
+// а сервер за TenantScopeMiddleware показывает только пользователей этого арендатора
+func WithTenantScope(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// tenantFromContext возвращает арендатора из WithTenantScope, пустой - без ограничения
+func tenantFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok && id != ""
+}
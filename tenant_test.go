@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TenantScopeMiddleware берёт арендатора из X-Tenant-ID и кладёт в контекст запроса, после чего поиск,
+// /users и выгрузки датасета видят только строки с таким же Row.TenantID. Без заголовка ограничения нет
+func TenantScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenant := r.Header.Get("X-Tenant-ID"); tenant != "" {
+			r = r.WithContext(WithTenantScope(r.Context(), tenant))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// inTenant - видна ли строка арендатору из контекста запроса, без арендатора видно всё
+func inTenant(ctx context.Context, row Row) bool {
+	tenant, ok := tenantFromContext(ctx)
+	return !ok || row.TenantID == tenant
+}
+
+// tenantRows оставляет из rows только строки арендатора из контекста запроса
+func tenantRows(ctx context.Context, rows []Row) []Row {
+	if _, ok := tenantFromContext(ctx); !ok {
+		return rows
+	}
+	out := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		if inTenant(ctx, row) {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+func TestTenantScope(t *testing.T) {
+	rows := []Row{
+		{ID: 0, FirstName: "Anna", LastName: "A", Gender: "female", TenantID: "acme"},
+		{ID: 1, FirstName: "Boris", LastName: "B", Gender: "male", TenantID: "acme"},
+		{ID: 2, FirstName: "Clara", LastName: "C", Gender: "female", TenantID: "globex"},
+		{ID: 3, FirstName: "Dmitry", LastName: "D", Gender: "male"},
+	}
+	ts := httptest.NewServer(TenantScopeMiddleware(NewSearchServer(WithDataSet(DataSet{Rows: rows}), WithSearchETags(true))))
+	defer ts.Close()
+	sc, err := NewSearchClient(ts.URL, "test_token", WithETagCache())
+	require.NoError(t, err)
+
+	ids := func(ctx context.Context) []int {
+		t.Helper()
+		resp, err := sc.Do(ctx, SearchRequest{Limit: 10, OrderField: "Id", OrderBy: OrderByAsc}, nil)
+		require.NoError(t, err)
+		out := []int{}
+		for _, u := range resp.Users {
+			out = append(out, u.Id)
+		}
+		return out
+	}
+
+	acme := WithTenantScope(context.Background(), "acme")
+	assert.Equal(t, []int{0, 1}, ids(acme))
+	assert.Equal(t, []int{2}, ids(WithTenantScope(context.Background(), "globex")))
+	assert.Empty(t, ids(WithTenantScope(context.Background(), "initech")))
+	assert.Equal(t, []int{0, 1, 2, 3}, ids(context.Background()))
+	// повтор из кеша ETag не должен подмешать выдачу другого арендатора
+	assert.Equal(t, []int{0, 1}, ids(acme))
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/search/count", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Tenant-ID", "globex")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var count int
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestTenantScope_Users(t *testing.T) {
+	rows := []Row{
+		{ID: 0, FirstName: "Anna", LastName: "A", Gender: "female", TenantID: "acme"},
+		{ID: 1, FirstName: "Boris", LastName: "B", Gender: "male", TenantID: "acme"},
+		{ID: 2, FirstName: "Clara", LastName: "C", Gender: "female", TenantID: "globex"},
+		{ID: 3, FirstName: "Dmitry", LastName: "D", Gender: "male"},
+	}
+	ts := httptest.NewServer(TenantScopeMiddleware(NewSearchServer(WithDataSet(DataSet{Rows: rows}), WithManagementToken("admin"))))
+	defer ts.Close()
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+	acme := WithTenantScope(context.Background(), "acme")
+	globex := WithTenantScope(context.Background(), "globex")
+	send := func(method, path, tenant, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant-ID", tenant)
+		req.Header.Set("Authorization", "Bearer admin")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	u, err := sc.FindUserByID(acme, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Anna A", u.Name)
+	_, err = sc.FindUserByID(acme, 2, false)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = sc.FindUserByID(context.Background(), 2, false)
+	assert.NoError(t, err, "no tenant - no scope")
+
+	users, err := sc.BulkFindUsersByIDs(globex, []int{0, 2, 3})
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+	assert.Nil(t, users[0])
+	require.NotNil(t, users[1])
+	assert.Equal(t, 2, users[1].Id)
+	assert.Nil(t, users[2])
+
+	_, etag, err := sc.FindUserWithETag(globex, 2, false)
+	require.NoError(t, err)
+	_, err = sc.UpdateUser(acme, User{Id: 2, Name: "Stolen Name"}, etag)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, "/users/2", "acme", "").StatusCode)
+	u, err = sc.FindUserByID(globex, 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Clara C", u.Name)
+
+	resp := send(http.MethodPost, "/users", "globex", `{"FirstName": "Eva"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	_, err = sc.FindUserByID(globex, 4, false)
+	assert.NoError(t, err)
+	_, err = sc.FindUserByID(acme, 4, false)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	resp = send(http.MethodGet, "/dataset.json", "acme", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var exported []Row
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&exported))
+	require.Len(t, exported, 2)
+	assert.Equal(t, []int{0, 1}, []int{exported[0].ID, exported[1].ID})
+
+	resp = send(http.MethodGet, "/dataset.xml", "globex", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "Clara")
+	assert.NotContains(t, string(body), "Anna")
+}
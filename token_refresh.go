@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithTokenRefresh - альтернатива WithTokenProvider для долгих сессий: клиент ходит с текущим токеном
+// (сначала AccessToken) и только на 401 берёт у refresh новый и один раз повторяет запрос.
+// Касается всех запросов клиента, с WithTokenProvider не сочетается
+func WithTokenRefresh(refresh func(ctx context.Context) (string, error)) Option {
+	return func(srv *SearchClient) error {
+		srv.tokenRefresh = refresh
+		return nil
+	}
+}
+
+// token - токен, с которым сейчас ходит клиент: обновлённый через WithTokenRefresh или AccessToken
+func (srv *SearchClient) token() string {
+	srv.refreshMu.Lock()
+	defer srv.refreshMu.Unlock()
+	if srv.refreshedToken != "" {
+		return srv.refreshedToken
+	}
+	return srv.AccessToken
+}
+
+// refreshToken получает новый токен взамен used. Если параллельный запрос уже успел обновить токен,
+// повторно refresh не вызывается
+func (srv *SearchClient) refreshToken(ctx context.Context, used string) error {
+	srv.refreshMu.Lock()
+	defer srv.refreshMu.Unlock()
+	current := srv.refreshedToken
+	if current == "" {
+		current = srv.AccessToken
+	}
+	if current != used {
+		return nil
+	}
+	token, err := srv.tokenRefresh(ctx)
+	if err != nil {
+		return fmt.Errorf("cant refresh access token: %w", err)
+	}
+	srv.refreshedToken = token
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTokenProvider(t *testing.T) {
+	var mu sync.Mutex
+	var auth, access []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth = append(auth, r.Header.Get("Authorization"))
+		access = append(access, r.Header.Get("AccessToken"))
+		mu.Unlock()
+		NewSearchServer().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	n := 0
+	sc, err := NewSearchClient(ts.URL, "static", WithTokenProvider(func(ctx context.Context) (string, error) {
+		n++
+		return "token-" + strconv.Itoa(n), nil
+	}))
+	require.NoError(t, err)
+
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	_, err = sc.FindUserByID(context.Background(), 1, false)
+	require.NoError(t, err)
+	_, err = sc.BulkFindUsersByIDs(context.Background(), []int{1})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-2", "Bearer token-3"}, auth)
+	assert.Equal(t, []string{"token-1", "token-2", "token-3"}, access)
+
+	failing, err := NewSearchClient(ts.URL, "static", WithTokenProvider(func(ctx context.Context) (string, error) {
+		return "", errTest
+	}))
+	require.NoError(t, err)
+	_, err = failing.FindUsers(SearchRequest{Limit: 1})
+	assert.ErrorIs(t, err, errTest)
+	_, err = failing.FindUserByID(context.Background(), 1, false)
+	assert.ErrorIs(t, err, errTest)
+	_, err = failing.BulkFindUsersByIDs(context.Background(), []int{1})
+	assert.ErrorIs(t, err, errTest)
+}
+
+func TestCachingTokenProvider(t *testing.T) {
+	calls := 0
+	fail := false
+	provider := CachingTokenProvider(50*time.Millisecond, func(ctx context.Context) (string, error) {
+		if fail {
+			return "", errors.New("idp down")
+		}
+		calls++
+		return "token-" + strconv.Itoa(calls), nil
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		tok, err := provider(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", tok)
+	}
+	assert.Equal(t, 1, calls)
+
+	time.Sleep(60 * time.Millisecond)
+	tok, err := provider(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", tok)
+
+	time.Sleep(60 * time.Millisecond)
+	fail = true
+	_, err = provider(ctx)
+	assert.EqualError(t, err, "idp down")
+}
+
+func TestWithTokenRefresh(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	valid := "token-1"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("AccessToken"))
+		ok := r.Header.Get("AccessToken") == valid
+		mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "expired")
+			return
+		}
+		r.Header.Set("AccessToken", "test_token")
+		NewSearchServer().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	refreshes := 0
+	sc, err := NewSearchClient(ts.URL, "expired", WithTokenRefresh(func(ctx context.Context) (string, error) {
+		refreshes++
+		return "token-" + strconv.Itoa(refreshes), nil
+	}))
+	require.NoError(t, err)
+
+	// первый запрос получает 401, второй с новым токеном - 200
+	res, err := sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, res.Users, 1)
+	assert.Equal(t, []string{"expired", "token-1"}, seen)
+	assert.Equal(t, 1, refreshes)
+
+	// пока токен жив, refresh не вызывается
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"expired", "token-1", "token-1"}, seen)
+	assert.Equal(t, 1, refreshes)
+
+	// новый токен тоже не подошёл - второй попытки нет
+	mu.Lock()
+	valid = "never"
+	seen = nil
+	mu.Unlock()
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	assert.EqualError(t, err, "Bad AccessToken")
+	assert.Equal(t, []string{"token-1", "token-2"}, seen)
+
+	failing, err := NewSearchClient(ts.URL, "expired", WithTokenRefresh(func(ctx context.Context) (string, error) {
+		return "", errTest
+	}))
+	require.NoError(t, err)
+	_, err = failing.FindUsers(SearchRequest{Limit: 1})
+	assert.ErrorIs(t, err, errTest)
+
+	_, err = NewSearchClient(ts.URL, "static",
+		WithTokenRefresh(func(ctx context.Context) (string, error) { return "", nil }),
+		WithTokenProvider(func(ctx context.Context) (string, error) { return "", nil }))
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TraceEvent - один замеренный шаг поиска
+type TraceEvent struct {
+	Step      string                 `json:"step"`
+	StartedAt time.Time              `json:"started_at"`
+	Duration  time.Duration          `json:"duration_ns"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func traceEvent(step string, start time.Time, meta map[string]interface{}) TraceEvent {
+	return TraceEvent{Step: step, StartedAt: start, Duration: time.Since(start), Metadata: meta}
+}
+
+// RequestTrace - трассировка одного запроса к /search
+type RequestTrace struct {
+	At     time.Time `json:"at"`
+	Params string    `json:"params"`
+	// trace-id из traceparent входящего запроса, если он был
+	TraceID string       `json:"trace_id,omitempty"`
+	Events  []TraceEvent `json:"events"`
+}
+
+// сколько последних трассировок помнит сервер
+const traceRingSize = 1000
+
+// traceRing - кольцевой буфер последних трассировок, старые затираются
+type traceRing struct {
+	mu     sync.Mutex
+	traces []RequestTrace
+	next   int
+}
+
+func (tr *traceRing) add(t RequestTrace) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if len(tr.traces) < traceRingSize {
+		tr.traces = append(tr.traces, t)
+		return
+	}
+	tr.traces[tr.next] = t
+	tr.next = (tr.next + 1) % traceRingSize
+}
+
+// last возвращает до n последних трассировок, самая свежая - первой
+func (tr *traceRing) last(n int) []RequestTrace {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if n > len(tr.traces) {
+		n = len(tr.traces)
+	}
+	out := make([]RequestTrace, 0, n)
+	for i := 0; i < n; i++ {
+		idx := (tr.next - 1 - i + 2*len(tr.traces)) % len(tr.traces)
+		out = append(out, tr.traces[idx])
+	}
+	return out
+}
+
+// Trace выполняет req внутри процесса и возвращает замеры шагов, работает и без SEARCH_TRACE
+func (s *SearchServer) Trace(ctx context.Context, req SearchRequest) ([]TraceEvent, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/search?"+req.values().Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	filter, err := s.parseSearchFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parseSearchPage(r)
+	if err != nil {
+		return nil, err
+	}
+	events := []TraceEvent{traceEvent("parse", start, nil)}
+	return append(events, s.execute(filter, page).steps...), nil
+}
+
+// сколько трассировок отдаёт /admin/traces без параметра last
+const defaultTracesLast = 10
+
+func (s *SearchServer) tracesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	last := defaultTracesLast
+	if v := r.FormValue("last"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid last")
+			return
+		}
+		last = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.traces.last(last))
+}
+
+func stepNames(events []TraceEvent) []string {
+	var names []string
+	for _, e := range events {
+		names = append(names, e.Step)
+	}
+	return names
+}
+
+func TestTraces(t *testing.T) {
+	t.Setenv("SEARCH_TRACE", "1")
+	ts := NewTestServer(t, WithManagementToken("admin"))
+	sc := ts.SearchClient("test_token")
+	for _, q := range []string{"first", "second", "third"} {
+		_, err := sc.FindUsers(SearchRequest{Limit: 1, Query: q})
+		require.NoError(t, err)
+	}
+
+	resp := adminRequest(t, http.MethodGet, ts.URL+"/admin/traces?last=2", "admin")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var traces []RequestTrace
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&traces))
+
+	require.Len(t, traces, 2)
+	assert.Contains(t, traces[0].Params, "query=third")
+	assert.Contains(t, traces[1].Params, "query=second")
+	assert.Equal(t, []string{"parse", "filter", "sort", "paginate", "encode"}, stepNames(traces[0].Events))
+	for _, e := range traces[0].Events {
+		assert.False(t, e.StartedAt.IsZero(), e.Step)
+	}
+
+	resp = adminRequest(t, http.MethodGet, ts.URL+"/admin/traces?last=0", "admin")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestTraces_Disabled(t *testing.T) {
+	t.Setenv("SEARCH_TRACE", "")
+	s := NewSearchServer()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?limit=1&offset=0&order_by=0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, s.traces.last(10))
+
+	events, err := s.Trace(context.Background(), SearchRequest{Limit: 3, OrderField: "Age", OrderBy: OrderByAsc})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"parse", "filter", "sort", "paginate"}, stepNames(events))
+	assert.Equal(t, 3, events[3].Metadata["rows_out"])
+
+	_, err = s.Trace(context.Background(), SearchRequest{Limit: 3, OrderField: "About"})
+	require.Error(t, err)
+}
+
+func TestTraceRing_Wraps(t *testing.T) {
+	var tr traceRing
+	for i := 0; i < traceRingSize+5; i++ {
+		tr.add(RequestTrace{Params: strconv.Itoa(i)})
+	}
+	got := tr.last(3)
+	assert.Equal(t, []string{"1004", "1003", "1002"}, []string{got[0].Params, got[1].Params, got[2].Params})
+	assert.Len(t, tr.last(5000), traceRingSize)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceContextMiddleware достаёт W3C traceparent из запроса в его контекст, откуда его подхватят
+// исходящие вызовы через SearchClient. trace-id отдаётся обратно в X-Trace-ID
+func TraceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		if id := traceID(ctx); id != "" {
+			w.Header().Set("X-Trace-ID", id)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// traceID - trace-id из контекста или пустая строка, если traceparent не было или он битый
+func traceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testTraceparent = "00-" + testTraceID + "-00f067aa0ba902b7-01"
+)
+
+func TestTraceparent_Echo(t *testing.T) {
+	t.Setenv("SEARCH_TRACE", "1")
+	s := NewSearchServer()
+	search := func(traceparent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/search?limit=1&offset=0&order_by=0", nil)
+		if traceparent != "" {
+			req.Header.Set("traceparent", traceparent)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec
+	}
+
+	assert.Equal(t, testTraceID, search(testTraceparent).Header().Get("X-Trace-ID"))
+	assert.Empty(t, search("").Header().Get("X-Trace-ID"))
+	assert.Empty(t, search("00-garbage-01").Header().Get("X-Trace-ID"))
+
+	traces := s.traces.last(3)
+	require.Len(t, traces, 3)
+	assert.Equal(t, testTraceID, traces[2].TraceID)
+	assert.Empty(t, traces[0].TraceID)
+}
+
+func TestTraceparent_PropagatedByClient(t *testing.T) {
+	var got string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+		json.NewEncoder(w).Encode([]User{})
+	}))
+	defer upstream.Close()
+
+	// обработчик, который сам ходит в другой поиск с контекстом входящего запроса
+	sc := &SearchClient{AccessToken: "test_token", URL: upstream.URL}
+	h := TraceContextMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := sc.Do(r.Context(), SearchRequest{Limit: 1}, nil)
+		require.NoError(t, err)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", testTraceparent)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, testTraceparent, got)
+}
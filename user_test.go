@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserText_RoundTrip(t *testing.T) {
+	cases := []User{
+		{},
+		{Id: 1, Name: "Boyd Wolf", Age: 22, About: "Nulla cillum & enim = ok?\n", Gender: "male"},
+		{Id: -5, Name: "", Age: 0, About: "", Gender: ""},
+		{Id: 34, Name: "Ångström Ü", Age: 150, About: "%20 +plus", Gender: "female"},
+	}
+	for _, u := range cases {
+		text, err := u.MarshalText()
+		require.NoError(t, err)
+		var got User
+		require.NoError(t, got.UnmarshalText(text))
+		assert.Equal(t, u, got)
+
+		again, err := got.MarshalText()
+		require.NoError(t, err)
+		assert.Equal(t, text, again)
+	}
+}
+
+func TestUserText_Errors(t *testing.T) {
+	var u User
+	assert.Error(t, u.UnmarshalText([]byte("%zz")))
+	assert.Error(t, u.UnmarshalText([]byte("Id=x&Age=1")))
+	assert.Error(t, u.UnmarshalText([]byte("Id=1&Age=x")))
+}
+
+func TestUser_AsMapKey(t *testing.T) {
+	in := map[User]int{
+		{Id: 1, Name: "A", Age: 20, Gender: "male"}: 1,
+		{Id: 2, Name: "B", About: "b"}:              2,
+	}
+	data, err := json.Marshal(in)
+	require.NoError(t, err)
+
+	out := map[User]int{}
+	require.NoError(t, json.Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+}
+
+func TestUser_JSONStaysObject(t *testing.T) {
+	u := User{Id: 1, Name: "A", Age: 20, About: "x", Gender: "male"}
+	data, err := json.Marshal(u)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Id":1,"Name":"A","Age":20,"About":"x","Gender":"male"}`, string(data))
+
+	var got User
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, u, got)
+}
+
+func TestUser_Sanitize(t *testing.T) {
+	u := User{Id: 42, Name: "Boyd Wolf", Age: 22, About: "lives at 1 Main St", Gender: "male"}
+	orig := u
+
+	assert.Equal(t, User{Id: 42, Name: "B. Wolf", Age: 22, About: "<redacted>", Gender: "male"}, u.Sanitize())
+	assert.Equal(t, orig, u)
+
+	for name, want := range map[string]string{
+		"":                  "",
+		"Boyd":              "B.",
+		"  Mary Ann Smith ": "M. Smith",
+		"Ångström Ü":        "Å. Ü",
+	} {
+		assert.Equal(t, want, User{Name: name}.Sanitize().Name, name)
+	}
+}
+
+func TestUser_Validate(t *testing.T) {
+	assert.NoError(t, User{Id: 0, Name: "Boyd Wolf", Age: 0, Gender: "male"}.Validate())
+	assert.NoError(t, User{Id: 34, Name: "A", Age: 150, Gender: "female"}.Validate())
+
+	err := User{Id: -1, Age: 151, Gender: "other"}.Validate()
+	var verr *UserValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, -1, verr.Id)
+	assert.Len(t, verr.Violations, 4)
+
+	err = User{Id: 3, Name: "A", Age: -1, Gender: "male"}.Validate()
+	require.True(t, errors.As(err, &verr))
+	assert.Len(t, verr.Violations, 1)
+	assert.Contains(t, err.Error(), "age")
+}
+
+func TestFindUsers_ValidateUsers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]User{{Id: 1, Name: "A", Age: 20, Gender: "male"}, {Id: 2, Age: -3, Gender: "male"}})
+	}))
+	defer ts.Close()
+
+	sc, err := NewSearchClient(ts.URL, "test_token")
+	require.NoError(t, err)
+	resp, err := sc.FindUsers(SearchRequest{Limit: 5})
+	require.NoError(t, err)
+	assert.Len(t, resp.Users, 2, "validation is off by default")
+
+	sc, err = NewSearchClient(ts.URL, "test_token", WithValidateUsers())
+	require.NoError(t, err)
+	_, err = sc.FindUsers(SearchRequest{Limit: 5})
+	var verr *UserValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, 2, verr.Id)
+	assert.Len(t, verr.Violations, 2)
+}
+
+func TestFindUsers_ValidateUsers_Dataset(t *testing.T) {
+	ts := NewTestServer(t)
+	sc, err := NewSearchClient(ts.URL, "test_token", WithValidateUsers())
+	require.NoError(t, err)
+	users, err := sc.PaginateAll(context.Background(), SearchRequest{})
+	require.NoError(t, err)
+	assert.Len(t, users, len(dataset.Rows))
+}
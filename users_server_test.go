@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *SearchServer) bulkUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req bulkUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if len(req.IDs) > maxBulkIDs {
+		writeError(w, http.StatusBadRequest, "too many ids")
+		return
+	}
+
+	rows := tenantRows(r.Context(), s.data().Rows)
+	byID := make(map[int]Row, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row
+	}
+	users := make([]*User, len(req.IDs))
+	for i, id := range req.IDs {
+		if row, ok := byID[id]; ok && row.DeletedAt.IsZero() {
+			u := rowToUser(row)
+			users[i] = &u
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// patchableUserFields - поля, которые можно менять через PATCH /users/{id}, Id менять нельзя
+var patchableUserFields = map[string]func(row *Row, raw json.RawMessage) error{
+	"FirstName": func(row *Row, raw json.RawMessage) error { return json.Unmarshal(raw, &row.FirstName) },
+	"LastName":  func(row *Row, raw json.RawMessage) error { return json.Unmarshal(raw, &row.LastName) },
+	"About":     func(row *Row, raw json.RawMessage) error { return json.Unmarshal(raw, &row.About) },
+	"IsActive":  func(row *Row, raw json.RawMessage) error { return json.Unmarshal(raw, &row.IsActive) },
+	"Gender":    func(row *Row, raw json.RawMessage) error { return json.Unmarshal(raw, &row.Gender) },
+	"Age":       func(row *Row, raw json.RawMessage) error { return json.Unmarshal(raw, &row.Age) },
+}
+
+var errPreconditionFailed = errors.New("user was modified")
+
+// rowETag - версия строки, меняется при любом изменении её полей
+func rowETag(row Row) string {
+	data, _ := json.Marshal(row)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+func (s *SearchServer) user(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/users/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.getUser(w, r, id)
+	case http.MethodPut:
+		s.putUser(w, r, id)
+	case http.MethodPatch:
+		s.patchUser(w, r, id)
+	case http.MethodDelete:
+		s.deleteUser(w, r, id)
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *SearchServer) getUser(w http.ResponseWriter, r *http.Request, id int) {
+	includeDeleted := r.FormValue("include_deleted") == "true"
+	for _, row := range s.data().Rows {
+		if row.ID == id && inTenant(r.Context(), row) && (includeDeleted || row.DeletedAt.IsZero()) {
+			writeUser(w, row)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, ErrUserNotFound.Error())
+}
+
+func writeUser(w http.ResponseWriter, row Row) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", rowETag(row))
+	json.NewEncoder(w).Encode(rowToUser(row))
+}
+
+// createUser добавляет пользователя с Id на единицу больше максимального
+func (s *SearchServer) createUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var upd userUpdate
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&upd); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	var created Row
+	err := s.updateRows(func(rows []Row) ([]Row, error) {
+		id := 0
+		for _, row := range rows {
+			if row.ID >= id {
+				id = row.ID + 1
+			}
+		}
+		// пользователь, созданный под арендатором, ему и принадлежит
+		tenant, _ := tenantFromContext(r.Context())
+		created = upd.apply(Row{ID: id, TenantID: tenant})
+		return append(rows, created), nil
+	}, func() { s.recordChange("create", r, nil, &created) })
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "cant save user: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/users/"+strconv.Itoa(created.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", rowETag(created))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rowToUser(created))
+}
+
+// userUpdate - тело PUT /users/{id}, заменяет все изменяемые поля.
+// IsActive в User нет, поэтому без него в теле прежнее значение сохраняется
+type userUpdate struct {
+	FirstName string
+	LastName  string
+	About     string
+	IsActive  *bool
+	Gender    string
+	Age       int
+}
+
+func (s *SearchServer) putUser(w http.ResponseWriter, r *http.Request, id int) {
+	var upd userUpdate
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&upd); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	s.mutateUser(w, r, id, "update", func(row *Row) error {
+		*row = upd.apply(*row)
+		return nil
+	})
+}
+
+func (upd userUpdate) apply(row Row) Row {
+	row.FirstName = upd.FirstName
+	row.LastName = upd.LastName
+	row.About = upd.About
+	if upd.IsActive != nil {
+		row.IsActive = *upd.IsActive
+	}
+	row.Gender = upd.Gender
+	row.Age = upd.Age
+	return row
+}
+
+func (s *SearchServer) patchUser(w http.ResponseWriter, r *http.Request, id int) {
+	// RawMessage, чтобы отличить отсутствующее поле от нулевого значения
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if _, ok := patch["Id"]; ok {
+		writeError(w, http.StatusBadRequest, "Id is immutable")
+		return
+	}
+	for field := range patch {
+		if _, ok := patchableUserFields[field]; !ok {
+			writeError(w, http.StatusBadRequest, "unknown field "+field)
+			return
+		}
+	}
+	s.mutateUser(w, r, id, "patch", func(row *Row) error {
+		for field, raw := range patch {
+			if err := patchableUserFields[field](row, raw); err != nil {
+				return fmt.Errorf("invalid %s: %s", field, err)
+			}
+		}
+		return nil
+	})
+}
+
+// deleteUser помечает пользователя удалённым, сама строка остаётся в датасете
+func (s *SearchServer) deleteUser(w http.ResponseWriter, r *http.Request, id int) {
+	var before, after Row
+	err := s.updateRows(func(rows []Row) ([]Row, error) {
+		for i := range rows {
+			if rows[i].ID == id && inTenant(r.Context(), rows[i]) && rows[i].DeletedAt.IsZero() {
+				before = rows[i]
+				rows[i].DeletedAt = time.Now().UTC()
+				after = rows[i]
+				return rows, nil
+			}
+		}
+		return nil, ErrUserNotFound
+	}, func() { s.recordChange("delete", r, &before, &after) })
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mutateUser применяет fn к строке пользователя, если If-Match совпадает с её текущим ETag.
+// Проверка и запись идут под одной блокировкой, так что из двух конкурентных правок с одним ETag пройдёт одна
+func (s *SearchServer) mutateUser(w http.ResponseWriter, r *http.Request, id int, op string, fn func(row *Row) error) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeError(w, http.StatusPreconditionRequired, "If-Match header is required")
+		return
+	}
+
+	var before, updated Row
+	err := s.updateRows(func(rows []Row) ([]Row, error) {
+		for i := range rows {
+			if rows[i].ID != id || !inTenant(r.Context(), rows[i]) || !rows[i].DeletedAt.IsZero() {
+				continue
+			}
+			if rowETag(rows[i]) != ifMatch {
+				return nil, errPreconditionFailed
+			}
+			row := rows[i]
+			if err := fn(&row); err != nil {
+				return nil, err
+			}
+			before = rows[i]
+			rows[i] = row
+			updated = row
+			return rows, nil
+		}
+		return nil, ErrUserNotFound
+	}, func() { s.recordChange(op, r, &before, &updated) })
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errPreconditionFailed):
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeUser(w, updated)
+	}
+}
+
+func TestServer_BulkUsers(t *testing.T) {
+	ts := NewTestServer(t)
+
+	post := func(body string) (*http.Response, []*User) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/users/bulk", "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var users []*User
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&users))
+		}
+		return resp, users
+	}
+
+	tooMany, _ := json.Marshal(bulkUsersRequest{IDs: make([]int, maxBulkIDs+1)})
+	exactly, _ := json.Marshal(bulkUsersRequest{IDs: make([]int, maxBulkIDs)})
+
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantIDs    []int // -1 - ждём null
+	}{
+		{"AllFound", `{"ids":[2,0,1]}`, http.StatusOK, []int{2, 0, 1}},
+		{"SomeMissing", `{"ids":[1,999,-5]}`, http.StatusOK, []int{1, -1, -1}},
+		{"Duplicates", `{"ids":[4,4]}`, http.StatusOK, []int{4, 4}},
+		{"Empty", `{"ids":[]}`, http.StatusOK, []int{}},
+		{"ExactlyMax", string(exactly), http.StatusOK, nil},
+		{"OverLimit", string(tooMany), http.StatusBadRequest, nil},
+		{"MalformedJSON", `{"ids":[1,`, http.StatusBadRequest, nil},
+		{"NonIntegerIDs", `{"ids":["1", 2.5]}`, http.StatusBadRequest, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, users := post(c.body)
+			require.Equal(t, c.wantStatus, resp.StatusCode)
+			if c.wantIDs == nil {
+				return
+			}
+			require.Len(t, users, len(c.wantIDs))
+			for i, id := range c.wantIDs {
+				if id < 0 {
+					assert.Nil(t, users[i])
+					continue
+				}
+				require.NotNil(t, users[i])
+				assert.Equal(t, rowToUser(dataset.Rows[id]), *users[i])
+			}
+		})
+	}
+
+	resp, err := http.Get(ts.URL + "/users/bulk")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestBulkFindUsersByIDs_RealServer(t *testing.T) {
+	ts := NewTestServer(t)
+	users, err := ts.SearchClient("test_token").BulkFindUsersByIDs(context.Background(), []int{5, 500, 5, 0})
+	require.NoError(t, err)
+	require.Len(t, users, 4)
+	assert.Equal(t, rowToUser(dataset.Rows[5]), *users[0])
+	assert.Nil(t, users[1])
+	assert.Equal(t, users[0], users[2])
+	assert.Equal(t, rowToUser(dataset.Rows[0]), *users[3])
+	assert.Empty(t, ts.received, "bulk endpoint should be used instead of search fallback")
+}
+
+func userRequest(t *testing.T, method, url, etag, body string) (*http.Response, User) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var u User
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&u))
+	}
+	return resp, u
+}
+
+func TestServer_PatchUser(t *testing.T) {
+	ts := NewTestServer(t)
+
+	resp, orig := userRequest(t, http.MethodGet, ts.URL+"/users/3", "", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, rowToUser(dataset.Rows[3]), orig)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	resp, u := userRequest(t, http.MethodPatch, ts.URL+"/users/3", etag, `{"Age": 99}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	want := orig
+	want.Age = 99
+	assert.Equal(t, want, u)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	etag = resp.Header.Get("ETag")
+
+	users, err := ts.SearchClient("test_token").BulkFindUsersByIDs(context.Background(), []int{3})
+	require.NoError(t, err)
+	assert.Equal(t, want, *users[0])
+	assert.Equal(t, orig, rowToUser(dataset.Rows[3]), "global dataset must not change")
+
+	resp, u = userRequest(t, http.MethodPatch, ts.URL+"/users/3", etag,
+		`{"FirstName": "", "About": "patched", "Gender": "female", "IsActive": true}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, " "+dataset.Rows[3].LastName, u.Name)
+	assert.Equal(t, "patched", u.About)
+	assert.Equal(t, 99, u.Age)
+	etag = resp.Header.Get("ETag")
+
+	for _, c := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/users/999", `{"Age": 1}`, http.StatusNotFound},
+		{"/users/abc", `{"Age": 1}`, http.StatusNotFound},
+		{"/users/3", `{"Id": 5}`, http.StatusBadRequest},
+		{"/users/3", `{"Name": "x"}`, http.StatusBadRequest},
+		{"/users/3", `{"Age": "old"}`, http.StatusBadRequest},
+		{"/users/3", `{`, http.StatusBadRequest},
+	} {
+		resp, _ := userRequest(t, http.MethodPatch, ts.URL+c.path, etag, c.body)
+		assert.Equal(t, c.status, resp.StatusCode, c.path+" "+c.body)
+	}
+
+	resp, _ = userRequest(t, http.MethodPost, ts.URL+"/users/3", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp, _ = userRequest(t, http.MethodGet, ts.URL+"/users/999", "", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_PutUser(t *testing.T) {
+	ts := NewTestServer(t)
+	resp, _ := userRequest(t, http.MethodGet, ts.URL+"/users/4", "", "")
+	etag := resp.Header.Get("ETag")
+
+	body := `{"FirstName":"New","LastName":"Name","About":"a","IsActive":true,"Gender":"female","Age":30}`
+	resp, u := userRequest(t, http.MethodPut, ts.URL+"/users/4", etag, body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, User{Id: 4, Name: "New Name", About: "a", Gender: "female", Age: 30}, u)
+
+	resp, _ = userRequest(t, http.MethodPut, ts.URL+"/users/4", resp.Header.Get("ETag"), `{"Id": 4}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = userRequest(t, http.MethodPut, ts.URL+"/users/999", etag, body)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_UserPreconditions(t *testing.T) {
+	ts := NewTestServer(t)
+	resp, _ := userRequest(t, http.MethodGet, ts.URL+"/users/5", "", "")
+	etag := resp.Header.Get("ETag")
+
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		resp, _ := userRequest(t, method, ts.URL+"/users/5", "", `{"Age": 1}`)
+		assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode, method)
+		resp, _ = userRequest(t, method, ts.URL+"/users/5", `"stale"`, `{"Age": 1}`)
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, method)
+	}
+
+	// две конкурентные правки с одним и тем же ETag - проходит ровно одна
+	var wg sync.WaitGroup
+	statuses := make([]int, 2)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodPatch, ts.URL+"/users/5", strings.NewReader(`{"Age": `+strconv.Itoa(40+i)+`}`))
+			if err != nil {
+				return
+			}
+			req.Header.Set("If-Match", etag)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	assert.ElementsMatch(t, []int{http.StatusOK, http.StatusPreconditionFailed}, statuses)
+}
+
+func TestServer_SoftDelete(t *testing.T) {
+	ts := NewTestServer(t)
+	sc := ts.SearchClient("test_token")
+	ctx := context.Background()
+	name := dataset.Rows[0].FirstName + " " + dataset.Rows[0].LastName
+
+	u, err := sc.FindUserByID(ctx, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, name, u.Name)
+
+	resp, _ := userRequest(t, http.MethodDelete, ts.URL+"/users/0", "", "")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = userRequest(t, http.MethodDelete, ts.URL+"/users/0", "", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, err = sc.FindUserByID(ctx, 0, false)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	u, err = sc.FindUserByID(ctx, 0, true)
+	require.NoError(t, err)
+	assert.Equal(t, name, u.Name)
+
+	res, err := sc.FindUsers(SearchRequest{Limit: 25, Query: name})
+	require.NoError(t, err)
+	assert.Empty(t, res.Users)
+	assert.Equal(t, 0, res.TotalCount)
+	res, err = sc.FindUsers(SearchRequest{Limit: 25, Query: name, IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Len(t, res.Users, 1)
+
+	users, err := sc.BulkFindUsersByIDs(ctx, []int{0, 1})
+	require.NoError(t, err)
+	assert.Nil(t, users[0])
+	assert.NotNil(t, users[1])
+
+	resp, _ = userRequest(t, http.MethodGet, ts.URL+"/users/0?include_deleted=true", "", "")
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	resp, _ = userRequest(t, http.MethodPatch, ts.URL+"/users/0", etag, `{"Age": 1}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestFindUserByID_Errors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("AccessToken") {
+		case "bad":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "garbage":
+			w.Write([]byte(`{`))
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	for token, want := range map[string]string{
+		"bad":     "Bad AccessToken",
+		"garbage": "cant unpack result json",
+		"other":   "status 500",
+	} {
+		sc := &SearchClient{AccessToken: token, URL: ts.URL}
+		_, err := sc.FindUserByID(context.Background(), 1, false)
+		require.Error(t, err, token)
+		assert.Contains(t, err.Error(), want)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// WatchQuery раз в interval повторяет req и отправляет в первый канал непустые отличия от прошлой выдачи.
+// Первая выдача - точка отсчёта, по ней ничего не отправляется. Ошибки запросов уходят во второй канал,
+// опрос после них продолжается со старой выдачей. Оба канала закрываются после отмены ctx
+func (srv *SearchClient) WatchQuery(ctx context.Context, req SearchRequest, interval time.Duration) (<-chan []UserDiff, <-chan error) {
+	diffs := make(chan []UserDiff)
+	errs := make(chan error)
+
+	go func() {
+		defer close(diffs)
+		defer close(errs)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var prev *SearchResponse
+		for {
+			resp, err := srv.Do(ctx, req, nil)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+			case prev == nil:
+				prev = resp
+			default:
+				if d := srv.DiffResults(prev, resp); len(d) > 0 {
+					select {
+					case diffs <- d:
+					case <-ctx.Done():
+						return
+					}
+				}
+				prev = resp
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return diffs, errs
+}
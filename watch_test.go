@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchQuery(t *testing.T) {
+	start := time.Now()
+	var fail atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			writeError(w, http.StatusInternalServerError, "boom")
+			return
+		}
+		// каждые 50ms выдача сдвигается на одного пользователя
+		step := int(time.Since(start) / (50 * time.Millisecond))
+		json.NewEncoder(w).Encode([]User{{Id: step}, {Id: step + 1}})
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{AccessToken: "test_token", URL: ts.URL}
+	ctx, cancel := context.WithCancel(context.Background())
+	interval := 20 * time.Millisecond
+	diffs, errs := sc.WatchQuery(ctx, SearchRequest{Limit: 5}, interval)
+
+	select {
+	case d := <-diffs:
+		require.Len(t, d, 2)
+		assert.Equal(t, UserDiffRemove, d[0].Op)
+		assert.Equal(t, UserDiffAdd, d[1].Op)
+		assert.Equal(t, d[0].Old.Id+2, d[1].New.Id)
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(50*time.Millisecond + 2*interval + 100*time.Millisecond):
+		t.Fatal("no diff emitted")
+	}
+
+	fail.Store(true)
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case <-diffs:
+		case err := <-errs:
+			assert.Contains(t, err.Error(), "fatal error")
+			done = true
+		case <-timeout:
+			t.Fatal("no error emitted")
+		}
+	}
+
+	cancel()
+	for range diffs {
+	}
+	for range errs {
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// сколько раз повторять недоставленный вебхук после первой попытки
+	webhookRetries        = 3
+	defaultWebhookBackoff = 100 * time.Millisecond
+	webhookTimeout        = 5 * time.Second
+)
+
+// WebhookEvent - тело вебхука об изменении пользователя
+type WebhookEvent struct {
+	// Seq записи журнала изменений: вебхуки доставляются параллельно, упорядочивать их надо по нему
+	Seq       uint64    `json:"seq"`
+	Event     string    `json:"event"`
+	User      User      `json:"user"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// операции журнала изменений -> события вебхука
+var webhookEvents = map[string]string{
+	"create": "user.created",
+	"import": "user.created",
+	"update": "user.updated",
+	"patch":  "user.updated",
+	"delete": "user.deleted",
+}
+
+type webhookNotifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+	// пауза перед первым повтором, дальше удваивается
+	backoff time.Duration
+	// ждёт доставки всего отправленного, нужен тестам
+	wg sync.WaitGroup
+}
+
+// WithWebhookNotifier включает вебхуки: после каждого создания, правки или удаления пользователя
+// сервер POST-ит на url WebhookEvent, подписанный HMAC-SHA256 от тела с ключом secret
+// в заголовке X-Webhook-Signature: sha256=<hex>. Отправка идёт в фоне и ответ на правку не задерживает,
+// недоставленное повторяется до трёх раз с удваивающейся паузой
+func WithWebhookNotifier(url string, secret []byte) ServerOption {
+	return func(s *SearchServer) {
+		s.webhook = &webhookNotifier{
+			url: url, secret: secret,
+			client:  &http.Client{Timeout: webhookTimeout},
+			backoff: defaultWebhookBackoff,
+		}
+	}
+}
+
+// webhookSignature - значение X-Webhook-Signature для тела body
+func webhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordChange пишет изменение в журнал и, если включены вебхуки, отправляет уведомление.
+// Вызывается из updateRows после сохранения и ещё под s.mu, иначе конкурентные правки
+// могли бы попасть в журнал не в том порядке, в каком сохранились
+func (s *SearchServer) recordChange(op string, r *http.Request, before, after *Row) {
+	entry := s.changelog.append(op, r, before, after)
+	if s.webhook == nil {
+		return
+	}
+	row := after
+	if row == nil {
+		row = before
+	}
+	event := WebhookEvent{Seq: entry.Seq, Event: webhookEvents[op], User: rowToUser(*row), Timestamp: entry.Timestamp}
+	// запрос уже отвечен к моменту доставки, от его контекста берём только трассу
+	s.webhook.notify(context.WithoutCancel(r.Context()), event)
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, event WebhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Default().Error("cant encode webhook", "event", event.Event, "error", err)
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		backoff := n.backoff
+		for attempt := 0; ; attempt++ {
+			err := n.deliver(ctx, body)
+			if err == nil {
+				return
+			}
+			if attempt == webhookRetries {
+				slog.Default().Warn("webhook delivery failed", "event", event.Event, "user_id", event.User.Id, "error", err)
+				return
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}()
+}
+
+func (n *webhookNotifier) deliver(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Signature", webhookSignature(n.secret, body))
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type webhookDelivery struct {
+	event       WebhookEvent
+	signature   string
+	traceparent string
+	body        []byte
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	secret := []byte("webhook-secret")
+	deliveries := make(chan webhookDelivery, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event WebhookEvent
+		require.NoError(t, json.Unmarshal(body, &event))
+		deliveries <- webhookDelivery{event, r.Header.Get("X-Webhook-Signature"), r.Header.Get("traceparent"), body}
+	}))
+	defer hook.Close()
+	ts := NewTestServer(t, WithWebhookNotifier(hook.URL, secret))
+	next := func() webhookDelivery {
+		t.Helper()
+		select {
+		case d := <-deliveries:
+			assert.Equal(t, webhookSignature(secret, d.body), d.signature)
+			assert.WithinDuration(t, time.Now(), d.event.Timestamp, time.Second)
+			return d
+		case <-time.After(time.Second):
+			require.FailNow(t, "webhook was not delivered")
+			return webhookDelivery{}
+		}
+	}
+
+	resp, created := userRequest(t, http.MethodPost, ts.URL+"/users", "",
+		`{"FirstName":"New","LastName":"User","Age":20,"Gender":"male"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	d := next()
+	assert.Equal(t, "user.created", d.event.Event)
+	assert.Equal(t, created, d.event.User)
+	assert.Equal(t, uint64(1), d.event.Seq)
+
+	id := fmt.Sprint(created.Id)
+	req, err := http.NewRequest(http.MethodPatch, ts.URL+"/users/"+id, strings.NewReader(`{"Age": 21}`))
+	require.NoError(t, err)
+	req.Header.Set("If-Match", resp.Header.Get("ETag"))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	d = next()
+	assert.Equal(t, "user.updated", d.event.Event)
+	assert.Equal(t, 21, d.event.User.Age)
+	assert.Contains(t, d.traceparent, "4bf92f3577b34da6a3ce929d0e0e4736", "webhook stays in the request trace")
+
+	resp, _ = userRequest(t, http.MethodDelete, ts.URL+"/users/"+id, "", "")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	d = next()
+	assert.Equal(t, "user.deleted", d.event.Event)
+	assert.Equal(t, created.Id, d.event.User.Id)
+	assert.Equal(t, uint64(3), d.event.Seq)
+}
+
+func TestWebhookNotifier_Retries(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []time.Time
+	failFirst := 2
+	release := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) <= failFirst {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer hook.Close()
+	s := NewSearchServer(WithDataSet(DataSet{Rows: []Row{{ID: 0, FirstName: "A"}}}), WithWebhookNotifier(hook.URL, nil))
+	s.webhook.backoff = 10 * time.Millisecond
+
+	// вебхук висит, а ответ на правку уже отдан
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/users/0", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	close(release)
+
+	s.webhook.wg.Wait()
+	require.Len(t, attempts, 3)
+	assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), 10*time.Millisecond)
+	assert.GreaterOrEqual(t, attempts[2].Sub(attempts[1]), 20*time.Millisecond)
+
+	// после трёх повторов сдаёмся
+	mu.Lock()
+	attempts, failFirst = nil, 100
+	mu.Unlock()
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"FirstName":"B"}`)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	s.webhook.wg.Wait()
+	assert.Len(t, attempts, 1+webhookRetries)
+}
+
+func TestWebhookNotifier_FailedSave(t *testing.T) {
+	var delivered atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer hook.Close()
+	key := []byte("0123456789abcdef")
+	c, err := newAboutCipher(key)
+	require.NoError(t, err)
+	rows, err := c.encryptRows([]Row{{ID: 0, FirstName: "A", About: "x"}})
+	require.NoError(t, err)
+	s := NewSearchServer(WithDataSet(DataSet{Rows: rows}), WithAboutEncryption(key), WithWebhookNotifier(hook.URL, nil))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, _ := userRequest(t, http.MethodGet, ts.URL+"/users/0", "", "")
+	etag := resp.Header.Get("ETag")
+	// строки расшифровываются, но зашифровать их обратно при сохранении уже не выйдет
+	s.aboutCipher.nonces = iotest.ErrReader(errors.New("no entropy"))
+
+	resp, _ = userRequest(t, http.MethodPost, ts.URL+"/users", "", `{"FirstName": "B"}`)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+	resp, _ = userRequest(t, http.MethodPatch, ts.URL+"/users/0", etag, `{"Age": 5}`)
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+	resp, _ = userRequest(t, http.MethodDelete, ts.URL+"/users/0", "", "")
+	assert.NotEqual(t, http.StatusNoContent, resp.StatusCode)
+
+	s.webhook.wg.Wait()
+	assert.Zero(t, delivered.Load(), "nothing was saved, nothing to notify about")
+	assert.Empty(t, s.changelog.list(-1, time.Time{}, 10))
+}